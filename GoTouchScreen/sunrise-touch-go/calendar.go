@@ -0,0 +1,845 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font/inconsolata"
+)
+
+// Agenda page: iCalendar (RFC 5545) events from a file, an http(s) URL or a
+// CalDAV collection ("caldav+https://..."), with the common RRULE forms
+// expanded locally. Credentials for URLs go in the userinfo part.
+
+type calEvent struct {
+	uid         string
+	summary     string
+	location    string
+	description string
+	start, end  time.Time
+	allDay      bool
+}
+
+// icsEvent is a VEVENT before recurrence expansion.
+type icsEvent struct {
+	calEvent
+	rrule        string
+	exdates      []time.Time
+	recurrenceID time.Time
+}
+
+type icsProp struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfoldICS joins continuation lines and splits content lines.
+func unfoldICS(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var out []string
+	for _, ln := range strings.Split(data, "\n") {
+		if (strings.HasPrefix(ln, " ") || strings.HasPrefix(ln, "\t")) && len(out) > 0 {
+			out[len(out)-1] += ln[1:]
+			continue
+		}
+		if ln != "" {
+			out = append(out, ln)
+		}
+	}
+	return out
+}
+
+func parseICSProp(ln string) icsProp {
+	// The value starts at the first colon outside a quoted parameter.
+	inQuote, colon := false, -1
+	for i, r := range ln {
+		if r == '"' {
+			inQuote = !inQuote
+		} else if r == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icsProp{name: strings.ToUpper(ln)}
+	}
+	parts := strings.Split(ln[:colon], ";")
+	p := icsProp{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: ln[colon+1:]}
+	for _, kv := range parts[1:] {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return p
+}
+
+func unescapeICS(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// icsLocation resolves a TZID. Some producers prefix IANA names with a path
+// (e.g. "/mozilla.org/20070129_1/Europe/Berlin"), so try trailing segments.
+func icsLocation(tzid string, fallback *time.Location) *time.Location {
+	if tzid == "" {
+		return fallback
+	}
+	segs := strings.Split(strings.Trim(tzid, "/"), "/")
+	for i := range segs {
+		if loc, err := time.LoadLocation(strings.Join(segs[i:], "/")); err == nil {
+			return loc
+		}
+	}
+	logCalendar.Debug("unknown TZID, using display zone", "tzid", tzid)
+	return fallback
+}
+
+// parseICSTime handles UTC ("...Z"), TZID-qualified, floating and DATE values;
+// floating times and dates are taken in loc.
+func parseICSTime(p icsProp, loc *time.Location) (t time.Time, allDay bool, err error) {
+	v := p.value
+	if p.params["VALUE"] == "DATE" || len(v) == 8 {
+		t, err = time.ParseInLocation("20060102", v, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err = time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+	t, err = time.ParseInLocation("20060102T150405", v, icsLocation(p.params["TZID"], loc))
+	return t, false, err
+}
+
+// parseICSDuration handles the RFC 5545 subset P[n]W / P[n]DT[n]H[n]M[n]S.
+func parseICSDuration(s string) (time.Duration, error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("duration %q", s)
+	}
+	var d time.Duration
+	num := ""
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			num += string(r)
+		case r == 'T':
+		default:
+			n, _ := strconv.Atoi(num)
+			num = ""
+			unit := map[rune]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}[r]
+			if unit == 0 {
+				return 0, fmt.Errorf("duration %q", s)
+			}
+			d += time.Duration(n) * unit
+		}
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseICS extracts VEVENTs; events without a usable DTSTART are skipped.
+func parseICS(data string, loc *time.Location) []icsEvent {
+	var out []icsEvent
+	var cur *icsEvent
+	var dur time.Duration
+	depth := 0
+	for _, ln := range unfoldICS(data) {
+		p := parseICSProp(ln)
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			cur, dur, depth = &icsEvent{}, 0, 0
+			continue
+		case cur == nil:
+			continue
+		case p.name == "BEGIN":
+			// Nested VALARM and the like.
+			depth++
+			continue
+		case p.name == "END" && depth > 0:
+			depth--
+			continue
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			if !cur.start.IsZero() {
+				if cur.end.IsZero() {
+					switch {
+					case dur != 0:
+						cur.end = cur.start.Add(dur)
+					case cur.allDay:
+						cur.end = cur.start.AddDate(0, 0, 1)
+					default:
+						cur.end = cur.start
+					}
+				}
+				out = append(out, *cur)
+			}
+			cur = nil
+			continue
+		case depth > 0:
+			continue
+		}
+		switch p.name {
+		case "UID":
+			cur.uid = p.value
+		case "SUMMARY":
+			cur.summary = unescapeICS(p.value)
+		case "LOCATION":
+			cur.location = unescapeICS(p.value)
+		case "DESCRIPTION":
+			cur.description = unescapeICS(p.value)
+		case "DTSTART":
+			if t, allDay, err := parseICSTime(p, loc); err == nil {
+				cur.start, cur.allDay = t, allDay
+			}
+		case "DTEND":
+			if t, _, err := parseICSTime(p, loc); err == nil {
+				cur.end = t
+			}
+		case "DURATION":
+			if d, err := parseICSDuration(p.value); err == nil {
+				dur = d
+			}
+		case "RRULE":
+			cur.rrule = p.value
+		case "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				q := p
+				q.value = v
+				if t, _, err := parseICSTime(q, loc); err == nil {
+					cur.exdates = append(cur.exdates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			if t, _, err := parseICSTime(p, loc); err == nil {
+				cur.recurrenceID = t
+			}
+		}
+	}
+	return out
+}
+
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []string // e.g. "MO", "1MO", "-1FR"
+	byMonthDay []int
+}
+
+func parseRRule(s string, loc *time.Location) (rrule, error) {
+	r := rrule{interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				r.interval = n
+			}
+		case "COUNT":
+			r.count, _ = strconv.Atoi(v)
+		case "UNTIL":
+			if t, allDay, err := parseICSTime(icsProp{value: v}, loc); err == nil {
+				r.until = t
+				if allDay {
+					// A date UNTIL includes the whole day.
+					r.until = t.AddDate(0, 0, 1).Add(-time.Second)
+				}
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(strings.ToUpper(v), ",") {
+				if validByDay(d) {
+					r.byDay = append(r.byDay, d)
+				}
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(v, ",") {
+				if n, err := strconv.Atoi(d); err == nil {
+					r.byMonthDay = append(r.byMonthDay, n)
+				}
+			}
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+		return r, nil
+	}
+	return r, fmt.Errorf("unsupported FREQ %q", r.freq)
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// validByDay accepts a BYDAY token: a weekday with an optional nonzero
+// ordinal ("MO", "1MO", "-1FR"). Feeds with anything else get it dropped.
+func validByDay(d string) bool {
+	if len(d) < 2 {
+		return false
+	}
+	if _, ok := icsWeekdays[d[len(d)-2:]]; !ok {
+		return false
+	}
+	if n := d[:len(d)-2]; n != "" {
+		v, err := strconv.Atoi(n)
+		return err == nil && v != 0 && v >= -5 && v <= 5
+	}
+	return true
+}
+
+// dayAt is day's date at the wall-clock time of tod, in tod's zone, so
+// recurrences keep their local time across DST changes.
+func dayAt(y int, m time.Month, d int, tod time.Time) time.Time {
+	return time.Date(y, m, d, tod.Hour(), tod.Minute(), tod.Second(), 0, tod.Location())
+}
+
+// nthWeekday returns the day of month of the nth (negative: from the end)
+// weekday wd, or 0 if there is none.
+func nthWeekday(y int, m time.Month, wd time.Weekday, n int) int {
+	days := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	var hits []int
+	for d := 1; d <= days; d++ {
+		if time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Weekday() == wd {
+			hits = append(hits, d)
+		}
+	}
+	if n > 0 && n <= len(hits) {
+		return hits[n-1]
+	}
+	if n < 0 && -n <= len(hits) {
+		return hits[len(hits)+n]
+	}
+	return 0
+}
+
+// periodOf returns the period k whose candidates are on or around t's date,
+// so expansion can start there instead of at DTSTART.
+func (r rrule) periodOf(start, t time.Time) int {
+	t = t.In(start.Location())
+	days := int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).
+		Sub(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	var k int
+	switch r.freq {
+	case "DAILY":
+		k = days / r.interval
+	case "WEEKLY":
+		k = (days + (int(start.Weekday())+6)%7) / 7 / r.interval
+	case "MONTHLY":
+		k = ((t.Year()-start.Year())*12 + int(t.Month()-start.Month())) / r.interval
+	case "YEARLY":
+		k = (t.Year() - start.Year()) / r.interval
+	}
+	return max(k, 0)
+}
+
+// candidates lists the starts in period k of the rule, in order.
+func (r rrule) candidates(start time.Time, k int) []time.Time {
+	var out []time.Time
+	switch r.freq {
+	case "DAILY":
+		out = append(out, dayAt(start.Year(), start.Month(), start.Day()+k*r.interval, start))
+	case "WEEKLY":
+		// Weeks start on Monday (the RFC 5545 default WKST).
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := start.Day() - offset + 7*k*r.interval
+		days := r.byDay
+		if len(days) == 0 {
+			days = []string{strings.ToUpper(start.Weekday().String()[:2])}
+		}
+		for _, d := range days {
+			wd, ok := icsWeekdays[d[len(d)-2:]]
+			if !ok {
+				continue
+			}
+			out = append(out, dayAt(start.Year(), start.Month(), monday+(int(wd)+6)%7, start))
+		}
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(k*r.interval), 1, 0, 0, 0, 0, time.UTC)
+		y, m := first.Year(), first.Month()
+		last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		var days []int
+		for _, d := range r.byDay {
+			wd, ok := icsWeekdays[d[len(d)-2:]]
+			if !ok {
+				continue
+			}
+			n, err := strconv.Atoi(d[:len(d)-2])
+			if err != nil {
+				// A bare weekday means every one in the month.
+				for i := 1; i <= 5; i++ {
+					if day := nthWeekday(y, m, wd, i); day > 0 {
+						days = append(days, day)
+					}
+				}
+				continue
+			}
+			if day := nthWeekday(y, m, wd, n); day > 0 {
+				days = append(days, day)
+			}
+		}
+		for _, d := range r.byMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			if d >= 1 && d <= last {
+				days = append(days, d)
+			}
+		}
+		if len(r.byDay) == 0 && len(r.byMonthDay) == 0 && start.Day() <= last {
+			days = append(days, start.Day())
+		}
+		for _, d := range days {
+			out = append(out, dayAt(y, m, d, start))
+		}
+	case "YEARLY":
+		y := start.Year() + k*r.interval
+		// Feb 29 only recurs in leap years.
+		if t := dayAt(y, start.Month(), start.Day(), start); t.Month() == start.Month() {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+// expand returns the occurrences of ev overlapping [from, to).
+func (ev icsEvent) expand(from, to time.Time, loc *time.Location) []calEvent {
+	length := ev.end.Sub(ev.start)
+	overlaps := func(s time.Time) bool {
+		return s.Before(to) && (s.Add(length).After(from) || (length == 0 && !s.Before(from)))
+	}
+	if ev.rrule == "" {
+		if overlaps(ev.start) {
+			return []calEvent{ev.calEvent}
+		}
+		return nil
+	}
+	r, err := parseRRule(ev.rrule, loc)
+	if err != nil {
+		logCalendar.Debug("rrule skipped", "uid", ev.uid, "err", err)
+		if overlaps(ev.start) {
+			return []calEvent{ev.calEvent}
+		}
+		return nil
+	}
+	var out []calEvent
+	n := 0
+	// COUNT has to be counted from DTSTART; otherwise skip ahead to the
+	// period holding the earliest occurrence that could still overlap from.
+	k0, limit := 0, 5000
+	if r.count > 0 {
+		// Sparse rules (5th Mondays, Feb 29) can leave periods empty.
+		limit += 4 * r.count
+	} else {
+		k0 = max(r.periodOf(ev.start, from.Add(-length))-1, 0)
+	}
+	// The period cap bounds work for rules that never produce a match.
+	for k := k0; k < k0+limit; k++ {
+		for _, s := range r.candidates(ev.start, k) {
+			if s.Before(ev.start) {
+				continue
+			}
+			if (!r.until.IsZero() && s.After(r.until)) || !s.Before(to) {
+				return out
+			}
+			n++
+			if r.count > 0 && n > r.count {
+				return out
+			}
+			excluded := false
+			for _, x := range ev.exdates {
+				if x.Equal(s) {
+					excluded = true
+				}
+			}
+			if !excluded && overlaps(s) {
+				c := ev.calEvent
+				c.start, c.end = s, s.Add(length)
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// expandEvents expands every event into [from, to), applying RECURRENCE-ID
+// overrides, and sorts all-day events first then by start.
+func expandEvents(evs []icsEvent, from, to time.Time, loc *time.Location) []calEvent {
+	overridden := map[string]bool{}
+	for _, ev := range evs {
+		if !ev.recurrenceID.IsZero() {
+			overridden[ev.uid+"@"+ev.recurrenceID.UTC().Format(time.RFC3339)] = true
+		}
+	}
+	var out []calEvent
+	for _, ev := range evs {
+		for _, c := range ev.expand(from, to, loc) {
+			if ev.recurrenceID.IsZero() && overridden[ev.uid+"@"+c.start.UTC().Format(time.RFC3339)] {
+				continue
+			}
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].start.Equal(out[j].start) {
+			return out[i].allDay && !out[j].allDay
+		}
+		return out[i].start.Before(out[j].start)
+	})
+	return out
+}
+
+// calendarService refetches the source in the background, like the weather
+// service, and hands the main loop expanded events on demand.
+type calendarService struct {
+	source  string
+	every   time.Duration
+	client  *http.Client
+	updated chan struct{}
+
+	mu        sync.Mutex
+	raw       string
+	fetched   time.Time
+	lastErr   error
+	parsed    []icsEvent // raw parsed in parsedLoc; nil after a fetch
+	parsedLoc *time.Location
+}
+
+// calendarLookahead is how far ahead next looks for the empty-agenda hint;
+// the CalDAV query asks for the same window.
+const calendarLookahead = 30
+
+func newCalendarService(source string, every time.Duration) *calendarService {
+	return &calendarService{
+		source:  source,
+		every:   every,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		updated: make(chan struct{}, 1),
+	}
+}
+
+func (c *calendarService) run(ctx context.Context) {
+	for {
+		data, err := c.load(ctx)
+		c.mu.Lock()
+		c.lastErr = err
+		if err == nil {
+			c.raw, c.fetched = data, time.Now()
+			c.parsed = nil
+		}
+		c.mu.Unlock()
+		if err != nil {
+			logCalendar.Warn("fetch failed", "err", err)
+		}
+		select {
+		case c.updated <- struct{}{}:
+		default:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.every):
+		}
+	}
+}
+
+func (c *calendarService) load(ctx context.Context) (string, error) {
+	switch {
+	case strings.HasPrefix(c.source, "caldav+"):
+		return c.loadCalDAV(ctx, strings.TrimPrefix(c.source, "caldav+"))
+	case strings.HasPrefix(c.source, "http://"), strings.HasPrefix(c.source, "https://"):
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.source, nil)
+		if err != nil {
+			return "", err
+		}
+		return c.do(req)
+	default:
+		b, err := os.ReadFile(c.source)
+		return string(b), err
+	}
+}
+
+func (c *calendarService) do(req *http.Request) (string, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("calendar: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	return string(b), err
+}
+
+// loadCalDAV runs a calendar-query REPORT for events around now and joins
+// the returned calendar-data into one ICS stream for parseICS.
+func (c *calendarService) loadCalDAV(ctx context.Context, url string) (string, error) {
+	now := time.Now().UTC()
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><C:calendar-data/></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+    <C:time-range start="%s" end="%s"/>
+  </C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`, now.AddDate(0, 0, -1).Format("20060102T150405Z"), now.AddDate(0, 0, calendarLookahead+2).Format("20060102T150405Z"))
+	req, err := http.NewRequestWithContext(ctx, "REPORT", url, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	data, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	var ms struct {
+		Data []string `xml:"response>propstat>prop>calendar-data"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader([]byte(data))).Decode(&ms); err != nil {
+		return "", fmt.Errorf("caldav: %w", err)
+	}
+	return strings.Join(ms.Data, "\n"), nil
+}
+
+// events returns the last fetch parsed in loc. It is parsed once per fetch,
+// and again only if the display time zone changes.
+func (c *calendarService) events(loc *time.Location) ([]icsEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.raw == "" {
+		if c.lastErr != nil {
+			return nil, c.lastErr
+		}
+		return nil, errors.New("loading")
+	}
+	if c.parsed == nil || c.parsedLoc != loc {
+		c.parsed, c.parsedLoc = parseICS(c.raw, loc), loc
+		if c.parsed == nil {
+			c.parsed = []icsEvent{}
+		}
+	}
+	return c.parsed, nil
+}
+
+// today returns the events still to come (or in progress) today in loc.
+func (c *calendarService) today(now time.Time) ([]calEvent, error) {
+	loc := now.Location()
+	evs, err := c.events(loc)
+	if err != nil {
+		return nil, err
+	}
+	y, m, d := now.Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	return expandEvents(evs, now, dayStart.AddDate(0, 0, 1), loc), nil
+}
+
+// next returns the first event after today, for the empty-agenda hint.
+func (c *calendarService) next(now time.Time) (calEvent, bool) {
+	loc := now.Location()
+	parsed, err := c.events(loc)
+	if err != nil {
+		return calEvent{}, false
+	}
+	y, m, d := now.Date()
+	tomorrow := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	evs := expandEvents(parsed, tomorrow, tomorrow.AddDate(0, 0, calendarLookahead), loc)
+	if len(evs) == 0 {
+		return calEvent{}, false
+	}
+	return evs[0], true
+}
+
+const agendaRows = 6
+
+func agendaRowRect(i int) rect {
+	y0 := 27 + i*15
+	return rect{2, y0, 123, y0 + 14}
+}
+
+// agendaVisible is how many events get a row; the last row becomes "+N more"
+// when they don't all fit.
+func agendaVisible(n int) int {
+	if n > agendaRows {
+		return agendaRows - 1
+	}
+	return n
+}
+
+// eventWhen is the five-character time column of an agenda row.
+func eventWhen(ev calEvent, loc *time.Location) string {
+	if ev.allDay {
+		return "  all"
+	}
+	return ev.start.In(loc).Format("15:04")
+}
+
+// truncate shortens s to n characters, marking the cut with a dot.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "."
+}
+
+// agendaPage keeps the events it last drew, so a tap maps to the row that
+// was on the panel. A tapped row opens full frame until BACK.
+type agendaPage struct {
+	pageDefaults
+	cal        *calendarService
+	shown      []calEvent
+	err        error
+	detail     calEvent
+	showDetail bool
+}
+
+func (*agendaPage) Title() string { return "agenda" }
+
+func (p *agendaPage) FullFrame() bool { return p.showDetail }
+
+func (p *agendaPage) Render(img *image.Gray, pc pageContext) {
+	if p.showDetail {
+		renderAgendaDetail(img, pc.now, p.detail, pc.th)
+		return
+	}
+	p.shown, p.err = nil, nil
+	if p.cal != nil {
+		p.shown, p.err = p.cal.today(pc.now)
+	}
+	renderAgendaPage(img, pc.now, p.shown, p.err, p.cal, pc.th)
+}
+
+func (p *agendaPage) HandleTouch(st *appState, x, y int) bool {
+	if p.showDetail {
+		if !inside(rect{2, 0, 62, 28}, x, y) {
+			return false
+		}
+		p.showDetail = false
+		logTouch.Debug("agenda: BACK")
+	} else {
+		i := agendaRowAt(len(p.shown), x, y)
+		if i < 0 {
+			return false
+		}
+		p.detail, p.showDetail = p.shown[i], true
+		logTouch.Debug("agenda: details", "event", p.detail.summary)
+	}
+	st.manualRedraw = true
+	return true
+}
+
+// NextRefresh also wakes for the next end among the drawn events, when it
+// drops off the list.
+func (p *agendaPage) NextRefresh(last time.Time, every time.Duration) time.Time {
+	next := last.Add(every)
+	for _, ev := range p.shown {
+		if ev.end.After(last) && ev.end.Before(next) {
+			next = ev.end
+		}
+	}
+	return next
+}
+
+func renderAgendaPage(img *image.Gray, now time.Time, evs []calEvent, err error, cal *calendarService, th uiTheme) {
+	fg := th.Foreground
+	text(img, 132, 50, now.Format("Mon Jan 2"), fg, th)
+	if cal == nil {
+		text(img, 8, 38, "AGENDA off", fg, th)
+		return
+	}
+	if err != nil && len(evs) == 0 {
+		text(img, 8, 38, "AGENDA", fg, th)
+		text(img, 8, 56, truncate(err.Error(), 16), fg, th)
+		return
+	}
+	if len(evs) == 0 {
+		text(img, 8, 38, "Nothing more", fg, th)
+		text(img, 8, 52, "today.", fg, th)
+		if ev, ok := cal.next(now); ok {
+			text(img, 8, 80, "Next "+ev.start.In(now.Location()).Format("Mon 15:04"), fg, th)
+			text(img, 8, 94, truncate(ev.summary, 16), fg, th)
+		}
+		return
+	}
+	shown := agendaVisible(len(evs))
+	for i := 0; i < shown; i++ {
+		r := agendaRowRect(i)
+		ev := evs[i]
+		when := eventWhen(ev, now.Location())
+		text(img, r.x0+2, r.y1-2, when+" "+truncate(ev.summary, 11), fg, th)
+		line(img, r.x0, r.y1, r.x1, r.y1, fg)
+	}
+	if shown < len(evs) {
+		r := agendaRowRect(shown)
+		text(img, r.x0+2, r.y1-2, fmt.Sprintf("+%d more", len(evs)-shown), fg, th)
+	}
+	text(img, 132, 66, fmt.Sprintf("%d today", len(evs)), fg, th)
+	text(img, 132, 110, "tap for details", fg, th)
+}
+
+// renderAgendaDetail shows one event full screen, with BACK in the header.
+func renderAgendaDetail(img *image.Gray, now time.Time, ev calEvent, th uiTheme) {
+	fg := th.Foreground
+	line(img, 0, 22, 249, 22, fg)
+	drawButton(img, rect{4, 2, 60, 20}, "BACK", false, th)
+	loc := now.Location()
+	when := ev.start.In(loc).Format("Mon Jan 2")
+	if ev.allDay {
+		when += " all day"
+	} else {
+		when += " " + ev.start.In(loc).Format("15:04") + "-" + ev.end.In(loc).Format("15:04")
+	}
+	text(img, 66, 16, when, fg, th)
+
+	y := 40
+	for i, l := range wrapText(ev.summary, 30) {
+		if i == 2 {
+			break
+		}
+		textFace(img, 4, y, l, fg, inconsolata.Bold8x16)
+		y += 16
+	}
+	if ev.location != "" {
+		text(img, 4, y, "@ "+truncate(ev.location, 33), fg, th)
+		y += 13
+	}
+	lines := wrapText(strings.Join(strings.Fields(ev.description), " "), 35)
+	for i, l := range lines {
+		if y > 118 {
+			break
+		}
+		if y+13 > 118 && i < len(lines)-1 {
+			l = truncate(l, 32) + "..."
+		}
+		text(img, 4, y, l, fg, th)
+		y += 13
+	}
+}
+
+// agendaRowAt returns the event row under x, y out of n events, or -1.
+func agendaRowAt(n, x, y int) int {
+	for i := 0; i < agendaVisible(n); i++ {
+		if inside(agendaRowRect(i), x, y) {
+			return i
+		}
+	}
+	return -1
+}
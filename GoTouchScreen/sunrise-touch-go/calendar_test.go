@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func icsWith(rrule, dtstart string) string {
+	return strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:test-1",
+		"SUMMARY:Standup",
+		"DTSTART:" + dtstart,
+		"DTEND:" + strings.Replace(dtstart, "T0900", "T0930", 1),
+		"RRULE:" + rrule,
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+}
+
+func TestExpandRecurrences(t *testing.T) {
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC) // a Monday
+	tests := []struct {
+		name    string
+		rrule   string
+		dtstart string
+		from    time.Time
+		want    []string
+	}{
+		{"daily since 2010", "FREQ=DAILY", "20100104T090000Z", day, []string{"2026-10-19 09:00"}},
+		{"every other day since 2010", "FREQ=DAILY;INTERVAL=2", "20100105T090000Z", day, nil},
+		{"weekly since 2010", "FREQ=WEEKLY;BYDAY=MO,WE", "20100104T090000Z", day, []string{"2026-10-19 09:00"}},
+		{"monthly since 2010", "FREQ=MONTHLY", "20100119T090000Z", day, []string{"2026-10-19 09:00"}},
+		{"yearly since 2010", "FREQ=YEARLY", "20101019T090000Z", day, []string{"2026-10-19 09:00"}},
+		{"count ran out", "FREQ=DAILY;COUNT=10", "20100104T090000Z", day, nil},
+		{"count still running", "FREQ=DAILY;COUNT=7000", "20100104T090000Z", day, []string{"2026-10-19 09:00"}},
+		{"until passed", "FREQ=DAILY;UNTIL=20260101", "20100104T090000Z", day, nil},
+		{"last friday", "FREQ=MONTHLY;BYDAY=-1FR", "20260130T090000Z", time.Date(2026, 10, 30, 0, 0, 0, 0, time.UTC), []string{"2026-10-30 09:00"}},
+		{"empty byday", "FREQ=WEEKLY;BYDAY=", "20100104T090000Z", day, []string{"2026-10-19 09:00"}},
+		{"one-char byday", "FREQ=WEEKLY;BYDAY=M,X", "20100104T090000Z", day, []string{"2026-10-19 09:00"}},
+		{"malformed monthly byday", "FREQ=MONTHLY;BYDAY=,ZZMO,0MO", "20100119T090000Z", day, []string{"2026-10-19 09:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evs := parseICS(icsWith(tt.rrule, tt.dtstart), time.UTC)
+			var got []string
+			for _, ev := range expandEvents(evs, tt.from, tt.from.AddDate(0, 0, 1), time.UTC) {
+				got = append(got, ev.start.Format("2006-01-02 15:04"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarParsesOncePerFetch(t *testing.T) {
+	c := newCalendarService("", time.Hour)
+	c.raw = icsWith("FREQ=DAILY", "20100104T090000Z")
+	a, err := c.events(time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := c.events(time.UTC)
+	if &a[0] != &b[0] {
+		t.Error("second call re-parsed the feed")
+	}
+	if _, ok := c.next(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)); !ok {
+		t.Error("next found nothing")
+	}
+}
+
+func TestAgendaDetail(t *testing.T) {
+	start := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	p := &agendaPage{shown: []calEvent{{summary: "Standup", start: start, end: start.Add(15 * time.Minute)}}}
+	st := appState{pages: []Page{p}, themes: builtinThemes()}
+	var lat, lon float64
+	every, tz := 15*time.Minute, ""
+	tap := func(x, y int) {
+		st.manualRedraw = false
+		handleTouch(&st, x, y, x, y, &lat, &lon, &every, &tz, nil, "")
+	}
+
+	tap(60, 34) // the first row
+	if !fullFrame(p) || !st.manualRedraw || st.onPage() {
+		t.Fatalf("row tap: detail %v, redraw %v, onPage %v", p.showDetail, st.manualRedraw, st.onPage())
+	}
+	if p.detail.summary != "Standup" {
+		t.Errorf("detail = %+v", p.detail)
+	}
+	// The detail owns the frame: THEME's spot is BACK and the rest is inert.
+	theme := st.theme
+	tap(150, 80)
+	if !fullFrame(p) || st.manualRedraw {
+		t.Error("body tap left the detail view")
+	}
+	tap(30, 10)
+	if fullFrame(p) || !st.manualRedraw || st.theme != theme || !st.onPage() {
+		t.Errorf("BACK: detail %v, theme %d -> %d", p.showDetail, theme, st.theme)
+	}
+}
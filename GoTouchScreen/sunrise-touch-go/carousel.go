@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Carousel: an unattended display cycles its pages, each for its own dwell,
+// e.g. -rotate weather=10m,agenda=5m. A touch holds the current page for the
+// idle timeout before the rotation picks up again.
+
+const (
+	defaultDwell      = 5 * time.Minute
+	defaultRotateIdle = 2 * time.Minute
+	// minDwell keeps rotation inside the panel's full-refresh budget: every
+	// page change is a full refresh.
+	minDwell = time.Minute
+)
+
+type carouselStep struct {
+	page  string
+	dwell time.Duration
+}
+
+// parseRotation reads "page=dwell,page,..."; a bare page gets defaultDwell.
+// A page may appear more than once.
+func parseRotation(spec string) ([]carouselStep, error) {
+	var steps []carouselStep
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, dwellStr, hasDwell := strings.Cut(part, "=")
+		step := carouselStep{page: strings.TrimSpace(name), dwell: defaultDwell}
+		if hasDwell {
+			d, err := time.ParseDuration(strings.TrimSpace(dwellStr))
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("rotate: bad dwell %q for page %q", dwellStr, step.page)
+			}
+			step.dwell = max(d, minDwell)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+type carousel struct {
+	steps []carouselStep
+	idle  time.Duration
+	at    int       // step on the panel
+	next  time.Time // when the rotation moves on; zero until started
+}
+
+// newCarousel drops steps for pages that aren't enabled. Fewer than two
+// steps leave nothing to rotate, so it returns nil.
+func newCarousel(steps []carouselStep, idle time.Duration, pages []Page) (*carousel, []error) {
+	var errs []error
+	var kept []carouselStep
+	titles := pageTitles(pages)
+	for _, s := range steps {
+		if pageIndex(titles, s.page) < 0 {
+			errs = append(errs, fmt.Errorf("rotate: page %q not enabled (have %s)", s.page, strings.Join(titles, ", ")))
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if len(kept) < 2 {
+		if len(steps) > 0 {
+			errs = append(errs, fmt.Errorf("rotate: needs two or more enabled pages, off"))
+		}
+		return nil, errs
+	}
+	if idle <= 0 {
+		idle = defaultRotateIdle
+	}
+	return &carousel{steps: kept, idle: idle}, errs
+}
+
+func pageIndex(titles []string, name string) int {
+	for i, t := range titles {
+		if t == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// hold pauses the rotation after someone uses the panel; the page they left
+// up stays for at least the idle timeout.
+func (c *carousel) hold(now time.Time) {
+	if until := now.Add(c.idle); until.After(c.next) {
+		c.next = until
+		logApp.Debug("rotation: paused", "until", until.Format(time.TimeOnly))
+	}
+}
+
+// advance moves to the next step once its dwell is up and reports whether the
+// page changed. Menus and overlays hold the rotation until they're closed.
+// A page picked by hand that isn't in the rotation is followed by the first
+// step.
+func (c *carousel) advance(st *appState, now time.Time) bool {
+	if !st.onPage() || now.Before(c.next) {
+		return false
+	}
+	title := st.currentPage().Title()
+	cur := c.at
+	if c.steps[cur].page != title {
+		cur = -1
+		for i, s := range c.steps {
+			if s.page == title {
+				cur = i
+				break
+			}
+		}
+	}
+	j := 0
+	switch {
+	case cur >= 0 && c.next.IsZero():
+		// Starting on a page in the rotation: give it its dwell first.
+		j = cur
+	case cur >= 0:
+		j = (cur + 1) % len(c.steps)
+	}
+	c.at = j
+	c.next = now.Add(c.steps[j].dwell)
+	if c.steps[j].page == title {
+		return false
+	}
+	st.page = pageIndex(pageTitles(st.pages), c.steps[j].page)
+	st.manualRedraw = true
+	// A different page under a partial refresh ghosts badly; changing pages
+	// is also the natural point to clear what partials have built up.
+	st.refreshMode = refreshFull
+	logApp.Debug("rotation: page", "page", c.steps[j].page, "dwell", c.steps[j].dwell)
+	return true
+}
+
+// schedule makes the page's own refresh rotation-aware: a periodic redraw
+// that would land within half an interval of the next page change is left
+// to that change instead, rather than spending a refresh on a page about to
+// go away.
+func (c *carousel) schedule(next, last time.Time) time.Time {
+	if c.next.After(next) && c.next.Sub(next) < next.Sub(last)/2 {
+		return c.next
+	}
+	return next
+}
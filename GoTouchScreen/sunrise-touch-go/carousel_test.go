@@ -0,0 +1,154 @@
+package main
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+// namedPage is a blank page with just a title.
+type namedPage struct {
+	pageDefaults
+	title string
+}
+
+func (p namedPage) Title() string                 { return p.title }
+func (namedPage) Render(*image.Gray, pageContext) {}
+
+func namedPages(titles ...string) []Page {
+	var out []Page
+	for _, t := range titles {
+		out = append(out, namedPage{title: t})
+	}
+	return out
+}
+
+func TestParseRotation(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []carouselStep
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"weather=10m, agenda ,weather=30s", []carouselStep{{"weather", 10 * time.Minute}, {"agenda", defaultDwell}, {"weather", minDwell}}, false},
+		{"weather=soon", nil, true},
+		{"weather=-1m", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRotation(tt.spec)
+		if (err != nil) != tt.wantErr || len(got) != len(tt.want) {
+			t.Errorf("parseRotation(%q) = %v, %v", tt.spec, got, err)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("parseRotation(%q)[%d] = %v, want %v", tt.spec, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestNewCarouselSkipsDisabled(t *testing.T) {
+	pages := namedPages("sunrise", "stats")
+	steps, _ := parseRotation("sunrise,flights,stats")
+	c, errs := newCarousel(steps, 0, pages)
+	if c == nil || len(c.steps) != 2 || c.steps[1].page != "stats" || len(errs) != 1 {
+		t.Fatalf("carousel %+v, errs %v", c, errs)
+	}
+	if c.idle != defaultRotateIdle {
+		t.Errorf("idle %v, want the default", c.idle)
+	}
+	// One enabled page is nothing to rotate.
+	steps, _ = parseRotation("sunrise,flights")
+	if c, errs := newCarousel(steps, 0, pages); c != nil || len(errs) != 2 {
+		t.Errorf("single page: carousel %+v, errs %v", c, errs)
+	}
+}
+
+// TestCarouselAdvance drives the rotation with a fake clock: each row is an
+// action at an offset from the start, then a tick of advance.
+func TestCarouselAdvance(t *testing.T) {
+	steps, err := parseRotation("a=2m,b=1m,c=3m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := appState{pages: namedPages("a", "b", "c", "d")}
+	c, errs := newCarousel(steps, 2*time.Minute, st.pages)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	st.rotation = c
+	t0 := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		at      time.Duration
+		do      string // touch, page N, menu, close
+		want    string
+		changed bool
+	}{
+		// Starting on a page in the rotation gives it its dwell first.
+		{0, "", "a", false},
+		{time.Minute, "", "a", false},
+		{2 * time.Minute, "", "b", true},
+		{3 * time.Minute, "", "c", true},
+		// Round to the start.
+		{6 * time.Minute, "", "a", true},
+		// A touch holds the page for the idle time past its dwell (8m).
+		{7 * time.Minute, "touch", "a", false},
+		{8 * time.Minute, "", "a", false},
+		{9 * time.Minute, "", "b", true},
+		// A page picked by hand outside the rotation goes to the first step.
+		{9*time.Minute + 30*time.Second, "page 3", "d", false},
+		{10 * time.Minute, "", "a", true},
+		// An open menu holds the rotation until it closes.
+		{12 * time.Minute, "menu", "a", false},
+		{13 * time.Minute, "close", "b", true},
+		// Touching before the dwell is up and within the idle time of it
+		// pushes the change out to the idle time.
+		{13*time.Minute + 30*time.Second, "touch", "b", false},
+		{14 * time.Minute, "", "b", false},
+		{15*time.Minute + 30*time.Second, "", "c", true},
+	}
+	for _, tt := range tests {
+		now := t0.Add(tt.at)
+		switch tt.do {
+		case "touch":
+			c.hold(now)
+		case "page 3":
+			st.page = 3
+		case "menu":
+			st.showSettings = true
+		case "close":
+			st.showSettings = false
+		}
+		st.manualRedraw, st.refreshMode = false, refreshAuto
+		changed := c.advance(&st, now)
+		if got := st.currentPage().Title(); got != tt.want || changed != tt.changed {
+			t.Fatalf("at %v (%s): page %s changed %v, want %s %v", tt.at, tt.do, got, changed, tt.want, tt.changed)
+		}
+		if changed && (!st.manualRedraw || st.refreshMode != refreshFull) {
+			t.Errorf("at %v: page change without a full redraw", tt.at)
+		}
+	}
+}
+
+func TestCarouselSchedule(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	c := &carousel{next: t0.Add(10 * time.Minute)}
+	tests := []struct {
+		next, last time.Duration // from t0
+		want       time.Duration
+	}{
+		// Change 2m after a 5m-interval redraw: skip the redraw.
+		{8 * time.Minute, 3 * time.Minute, 10 * time.Minute},
+		// 4m after is more than half an interval: keep it.
+		{6 * time.Minute, time.Minute, 6 * time.Minute},
+		// The change comes first anyway.
+		{12 * time.Minute, 7 * time.Minute, 12 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := c.schedule(t0.Add(tt.next), t0.Add(tt.last)); !got.Equal(t0.Add(tt.want)) {
+			t.Errorf("schedule(%v, %v) = %v, want %v", tt.next, tt.last, got.Sub(t0), tt.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+// favoriteCity is stored in full rather than by name so favorites keep
+// working if the embedded gazetteer changes.
+type favoriteCity struct {
+	Name     string  `json:"name"`
+	Country  string  `json:"country"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Timezone string  `json:"timezone"`
+}
+
+const (
+	pickByLetter = iota
+	pickByCountry
+	pickFavorites
+)
+
+// Picker geometry: an index grid of letters or country codes, or a list of
+// cities with a favorite toggle on each row.
+const (
+	pickerCols     = 7
+	pickerRows     = 4
+	pickerListRows = 4
+)
+
+func pickerCellRect(i int) rect {
+	col, row := i%pickerCols, i/pickerCols
+	x0 := 4 + col*35
+	y0 := 26 + row*24
+	return rect{x0, y0, x0 + 32, y0 + 21}
+}
+
+func pickerRowRect(i int) rect {
+	y0 := 26 + i*24
+	return rect{4, y0, 216, y0 + 21}
+}
+
+func pickerStarRect(i int) rect {
+	y0 := 26 + i*24
+	return rect{222, y0, 246, y0 + 21}
+}
+
+// pickerIndex lists the letters or countries that have at least one city.
+func pickerIndex(mode int) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, c := range cities {
+		k := c.country
+		if mode == pickByLetter {
+			k = strings.ToUpper(c.name[:1])
+		}
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func pickerCities(mode int, key string, favs []favoriteCity) []favoriteCity {
+	if mode == pickFavorites {
+		return favs
+	}
+	var out []favoriteCity
+	for _, c := range cities {
+		if (mode == pickByLetter && strings.EqualFold(c.name[:1], key)) || (mode == pickByCountry && c.country == key) {
+			out = append(out, favoriteCity{Name: c.name, Country: c.country, Lat: c.lat, Lon: c.lon, Timezone: c.tz})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func favoriteIndex(favs []favoriteCity, c favoriteCity) int {
+	for i, f := range favs {
+		if f.Name == c.Name && f.Country == c.Country {
+			return i
+		}
+	}
+	return -1
+}
+
+// pickerListing is what the picker currently shows: index keys when browsing
+// the letter/country grid, otherwise cities.
+func pickerListing(st appState) (keys []string, list []favoriteCity, perPage int) {
+	if st.pickerMode != pickFavorites && st.pickerKey == "" {
+		return pickerIndex(st.pickerMode), nil, pickerCols * pickerRows
+	}
+	return nil, pickerCities(st.pickerMode, st.pickerKey, st.favorites), pickerListRows
+}
+
+func openCityPicker(st *appState) {
+	st.showCityPicker = true
+	st.pickerMode = pickByLetter
+	st.pickerKey = ""
+	st.pickerPage = 0
+	if len(st.favorites) > 0 {
+		st.pickerMode = pickFavorites
+	}
+	st.manualRedraw = true
+}
+
+func handleCityPickerTouch(st *appState, x, y int, configPath string) {
+	buttonBack := rect{2, 0, 62, 28}
+	buttonMode := rect{63, 0, 124, 28}
+	buttonPrev := rect{125, 0, 186, 28}
+	buttonNext := rect{187, 0, 249, 28}
+
+	keys, list, perPage := pickerListing(*st)
+	n := len(keys) + len(list)
+	pages := (n + perPage - 1) / perPage
+	st.manualRedraw = true
+
+	switch {
+	case inside(buttonBack, x, y):
+		if st.pickerKey != "" {
+			st.pickerKey = ""
+			st.pickerPage = 0
+		} else {
+			st.showCityPicker = false
+		}
+		return
+	case inside(buttonMode, x, y):
+		st.pickerMode = (st.pickerMode + 1) % 3
+		st.pickerKey = ""
+		st.pickerPage = 0
+		return
+	case inside(buttonPrev, x, y):
+		if st.pickerPage > 0 {
+			st.pickerPage--
+		}
+		return
+	case inside(buttonNext, x, y):
+		if st.pickerPage+1 < pages {
+			st.pickerPage++
+		}
+		return
+	}
+
+	first := st.pickerPage * perPage
+	if keys != nil {
+		for i := 0; i < perPage && first+i < len(keys); i++ {
+			if inside(pickerCellRect(i), x, y) {
+				st.pickerKey = keys[first+i]
+				st.pickerPage = 0
+				return
+			}
+		}
+		st.manualRedraw = false
+		return
+	}
+	for i := 0; i < perPage && first+i < len(list); i++ {
+		c := list[first+i]
+		switch {
+		case inside(pickerStarRect(i), x, y):
+			if fi := favoriteIndex(st.favorites, c); fi >= 0 {
+				st.favorites = append(st.favorites[:fi:fi], st.favorites[fi+1:]...)
+			} else {
+				st.favorites = append(st.favorites, c)
+			}
+			if err := persistFavorites(configPath, st.favorites); err != nil {
+				logConfig.Error("favorites save failed", "err", err)
+			}
+			return
+		case inside(pickerRowRect(i), x, y):
+			st.settingsLat = c.Lat
+			st.settingsLon = c.Lon
+			st.settingsTimezone = c.Timezone
+			st.showCityPicker = false
+			logTouch.Info("city picked", "city", c.Name, "country", c.Country, "lat", c.Lat, "lon", c.Lon, "tz", c.Timezone)
+			return
+		}
+	}
+	st.manualRedraw = false
+}
+
+func renderCityPickerView(img *image.Gray, st appState, th uiTheme) {
+	fg := th.Foreground
+	line(img, 0, 22, 249, 22, fg)
+	drawButton(img, rect{4, 2, 60, 20}, "BACK", false, th)
+	modeLabel := [...]string{"A-Z", "CTRY", "FAV"}[st.pickerMode]
+	drawButton(img, rect{64, 2, 120, 20}, modeLabel, false, th)
+
+	keys, list, perPage := pickerListing(st)
+	n := len(keys) + len(list)
+	pages := (n + perPage - 1) / perPage
+	drawButton(img, rect{124, 2, 180, 20}, "<", false, th)
+	nextLabel := ">"
+	if pages > 1 {
+		nextLabel = fmt.Sprintf("%d/%d >", st.pickerPage+1, pages)
+	}
+	drawButton(img, rect{184, 2, 246, 20}, nextLabel, false, th)
+
+	if n == 0 {
+		if st.pickerMode == pickFavorites {
+			text(img, 8, 44, "No favorites yet.", fg, th)
+			text(img, 8, 62, "Tap * next to a city", fg, th)
+			text(img, 8, 80, "to add it here.", fg, th)
+		} else {
+			text(img, 8, 44, "No cities", fg, th)
+		}
+		return
+	}
+
+	first := st.pickerPage * perPage
+	if keys != nil {
+		for i := 0; i < perPage && first+i < len(keys); i++ {
+			drawButton(img, pickerCellRect(i), keys[first+i], false, th)
+		}
+	} else {
+		for i := 0; i < perPage && first+i < len(list); i++ {
+			c := list[first+i]
+			label := c.Name
+			if len(label) > 22 {
+				label = label[:21] + "."
+			}
+			drawButton(img, pickerRowRect(i), fmt.Sprintf("%-22s %s", label, c.Country), false, th)
+			drawButton(img, pickerStarRect(i), "*", favoriteIndex(st.favorites, c) >= 0, th)
+		}
+	}
+}
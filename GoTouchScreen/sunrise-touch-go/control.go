@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The control API lets ops tooling drive the dashboard over HTTP. Handlers
+// never touch appState directly: each request is queued as a controlCmd and
+// run by the main loop between polls, the same place touches are handled.
+
+const (
+	refreshAuto = iota
+	refreshFull
+	refreshPartial
+)
+
+// controlTarget is the main loop's state as seen by a control command.
+type controlTarget struct {
+	st           *appState
+	lat, lon     *float64
+	refreshEvery *time.Duration
+	timezone     *string
+	cal          *touchCalibration
+	configPath   string
+	frame        *image.Gray
+	lastDraw     time.Time
+	drawCount    int
+}
+
+type controlReply struct {
+	v   any
+	err error
+}
+
+type controlCmd struct {
+	run  func(t *controlTarget) (any, error)
+	resp chan controlReply
+}
+
+type controlServer struct {
+	cmds chan controlCmd
+	srv  *http.Server
+}
+
+// listenControl binds addr, either host:port or unix:/path/to.sock.
+func listenControl(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// A socket left by an unclean exit would block the bind.
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0o660); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+func startControlServer(addr string) (*controlServer, error) {
+	ln, err := listenControl(addr)
+	if err != nil {
+		return nil, fmt.Errorf("control api: %w", err)
+	}
+	s := &controlServer{cmds: make(chan controlCmd)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/state", s.handleState)
+	mux.HandleFunc("/api/page", s.handlePage)
+	mux.HandleFunc("/api/theme", s.handleTheme)
+	mux.HandleFunc("/api/refresh", s.handleRefresh)
+	mux.HandleFunc("/api/settings", s.handleSettings)
+	mux.HandleFunc("/api/frame.png", s.handleFrame)
+	mux.HandleFunc("/api/message", s.handleMessage)
+	mux.Handle("/metrics", appMetrics)
+	mux.HandleFunc("/api/log", handleLogLevels)
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logApp.Error("control api stopped", "err", err)
+		}
+	}()
+	logApp.Info("control api listening", "addr", addr)
+	return s, nil
+}
+
+func (s *controlServer) Close() error {
+	return s.srv.Close()
+}
+
+// do hands fn to the main loop and waits for its result. A full refresh can
+// hold the loop for a few seconds, so give up after a while.
+func (s *controlServer) do(r *http.Request, fn func(t *controlTarget) (any, error)) (any, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	cmd := controlCmd{run: fn, resp: make(chan controlReply, 1)}
+	select {
+	case s.cmds <- cmd:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case rep := <-cmd.resp:
+		return rep.v, rep.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logApp.Debug("control api write failed", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errInvalidSetting):
+		code = http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// reply runs fn on the main loop and writes its result as JSON.
+func (s *controlServer) reply(w http.ResponseWriter, r *http.Request, fn func(t *controlTarget) (any, error)) {
+	v, err := s.do(r, fn)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func requirePost(w http.ResponseWriter, r *http.Request, body any) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return false
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad json: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+type controlState struct {
+	View            string     `json:"view"`
+	Page            string     `json:"page"`
+	Pages           []string   `json:"pages"`
+	Theme           string     `json:"theme"`
+	Themes          []string   `json:"themes"`
+	Lat             float64    `json:"lat"`
+	Lon             float64    `json:"lon"`
+	IntervalSeconds int64      `json:"interval_seconds"`
+	Timezone        string     `json:"timezone"`
+	ExitArmed       bool       `json:"exit_armed"`
+	LastDraw        time.Time  `json:"last_draw"`
+	Draws           int        `json:"draws"`
+	Messages        int        `json:"messages"`
+	RotateAt        *time.Time `json:"rotate_at,omitempty"`
+}
+
+func (t *controlTarget) state() controlState {
+	st := t.st
+	view := "main"
+	switch {
+	case st.showCalibration:
+		view = "calibration"
+	case st.showKeypad:
+		view = "keypad"
+	case st.showCityPicker:
+		view = "city-picker"
+	case st.showSettings:
+		view = "settings"
+	}
+	cs := controlState{
+		View:            view,
+		Page:            st.currentPage().Title(),
+		Pages:           pageTitles(st.pages),
+		Theme:           st.currentTheme().Name,
+		Lat:             *t.lat,
+		Lon:             *t.lon,
+		IntervalSeconds: int64(*t.refreshEvery / time.Second),
+		Timezone:        *t.timezone,
+		ExitArmed:       !st.exitArmedUntil.IsZero(),
+		LastDraw:        t.lastDraw,
+		Draws:           t.drawCount,
+		Messages:        len(st.overlays),
+	}
+	if st.rotation != nil && !st.rotation.next.IsZero() {
+		at := st.rotation.next
+		cs.RotateAt = &at
+	}
+	for _, th := range st.themes {
+		cs.Themes = append(cs.Themes, th.Name)
+	}
+	return cs
+}
+
+// closeViews drops back to the main view so a remote change is visible.
+func closeViews(st *appState) {
+	st.showSettings = false
+	st.showCalibration = false
+	st.showKeypad = false
+	st.showCityPicker = false
+}
+
+func (s *controlServer) handleState(w http.ResponseWriter, r *http.Request) {
+	s.reply(w, r, func(t *controlTarget) (any, error) {
+		return t.state(), nil
+	})
+}
+
+// POST /api/page {"page": "moon"} selects by name, index or "next".
+func (s *controlServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Page string `json:"page"`
+	}
+	if !requirePost(w, r, &req) {
+		return
+	}
+	s.reply(w, r, func(t *controlTarget) (any, error) {
+		if err := t.selectPage(req.Page); err != nil {
+			return nil, err
+		}
+		return t.state(), nil
+	})
+}
+
+// selectPage, selectTheme and queueRefresh are shared by the HTTP and MQTT
+// command paths.
+func (t *controlTarget) selectPage(page string) error {
+	p := -1
+	if page == "next" {
+		p = (t.st.page + 1) % len(t.st.pages)
+	} else if n, err := strconv.Atoi(page); err == nil && n >= 0 && n < len(t.st.pages) {
+		p = n
+	} else {
+		for i, pg := range t.st.pages {
+			if pg.Title() == page {
+				p = i
+			}
+		}
+	}
+	if p < 0 {
+		return fmt.Errorf("%w: unknown page %q", errInvalidSetting, page)
+	}
+	closeViews(t.st)
+	t.st.page = p
+	if t.st.rotation != nil {
+		t.st.rotation.hold(time.Now())
+	}
+	t.st.manualRedraw = true
+	logApp.Info("control: page", "page", t.st.currentPage().Title())
+	return nil
+}
+
+func (t *controlTarget) selectTheme(theme string) error {
+	i := themeIndex(t.st.themes, theme)
+	if theme == "next" {
+		i = t.st.nextTheme()
+	}
+	if i < 0 {
+		return fmt.Errorf("%w: theme %q not installed", errInvalidSetting, theme)
+	}
+	t.st.theme = i
+	t.st.manualRedraw = true
+	logApp.Info("control: theme", "theme", t.st.currentTheme().Name)
+	return nil
+}
+
+func (t *controlTarget) queueRefresh(mode string) error {
+	switch mode {
+	case "", "full":
+		t.st.refreshMode = refreshFull
+	case "partial":
+		t.st.refreshMode = refreshPartial
+	default:
+		return fmt.Errorf("%w: refresh mode %q", errInvalidSetting, mode)
+	}
+	t.st.manualRedraw = true
+	logApp.Info("control: refresh", "mode", mode)
+	return nil
+}
+
+// POST /api/theme {"theme": "dark"} selects by name or "next".
+func (s *controlServer) handleTheme(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Theme string `json:"theme"`
+	}
+	if !requirePost(w, r, &req) {
+		return
+	}
+	s.reply(w, r, func(t *controlTarget) (any, error) {
+		if err := t.selectTheme(req.Theme); err != nil {
+			return nil, err
+		}
+		return t.state(), nil
+	})
+}
+
+// POST /api/refresh {"mode": "full"|"partial"} redraws on the next loop.
+func (s *controlServer) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if !requirePost(w, r, &req) {
+		return
+	}
+	s.reply(w, r, func(t *controlTarget) (any, error) {
+		if req.Mode == "" {
+			req.Mode = "full"
+		}
+		if err := t.queueRefresh(req.Mode); err != nil {
+			return nil, err
+		}
+		return map[string]string{"queued": req.Mode}, nil
+	})
+}
+
+// POST /api/settings {"lat": 51.5, "lon": -0.12, "interval_seconds": 900,
+// "timezone": "America/Chicago"}. Omitted fields keep their current value.
+func (s *controlServer) handleSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Lat             *float64 `json:"lat"`
+		Lon             *float64 `json:"lon"`
+		IntervalSeconds *int64   `json:"interval_seconds"`
+		Timezone        *string  `json:"timezone"`
+	}
+	if !requirePost(w, r, &req) {
+		return
+	}
+	s.reply(w, r, func(t *controlTarget) (any, error) {
+		lat, lon, every, tz := *t.lat, *t.lon, *t.refreshEvery, *t.timezone
+		if req.Lat != nil {
+			lat = *req.Lat
+		}
+		if req.Lon != nil {
+			lon = *req.Lon
+		}
+		if req.IntervalSeconds != nil {
+			every = time.Duration(*req.IntervalSeconds) * time.Second
+		}
+		if req.Timezone != nil {
+			tz = *req.Timezone
+		}
+		if err := applySettings(t.st, lat, lon, every, tz, t.lat, t.lon, t.refreshEvery, t.timezone, t.cal, t.configPath); err != nil {
+			return nil, err
+		}
+		logConfig.Info("control: settings", "lat", lat, "lon", lon, "interval", every, "tz", tz)
+		return t.state(), nil
+	})
+}
+
+// GET /api/frame.png returns the last frame sent to the panel, landscape.
+func (s *controlServer) handleFrame(w http.ResponseWriter, r *http.Request) {
+	v, err := s.do(r, func(t *controlTarget) (any, error) {
+		return t.frame, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	frame, _ := v.(*image.Gray)
+	if frame == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "nothing drawn yet"})
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, frame); err != nil {
+		logApp.Debug("control api frame write failed", "err", err)
+	}
+}
+
+// POST /api/message shows an image or markdown note as an overlay (see
+// parseOverlay); DELETE /api/message?id=N removes one, or all without id.
+func (s *controlServer) handleMessage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		// Decode and dither here, off the main loop.
+		o, err := parseOverlay(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		s.reply(w, r, func(t *controlTarget) (any, error) {
+			id := pushOverlay(t.st, o)
+			logApp.Info("control: message", "id", id, "priority", o.priority)
+			return map[string]int{"id": id}, nil
+		})
+	case http.MethodDelete:
+		// Only a missing id clears everything; a bad one must not.
+		all := !r.URL.Query().Has("id")
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if !all && (err != nil || id <= 0) {
+			writeError(w, fmt.Errorf("%w: id %q", errInvalidSetting, r.URL.Query().Get("id")))
+			return
+		}
+		s.reply(w, r, func(t *controlTarget) (any, error) {
+			removed := removeOverlays(t.st, func(o overlay) bool { return !all && o.id != id })
+			return map[string]bool{"removed": removed}, nil
+		})
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST or DELETE"})
+	}
+}
+
+// GET /api/log lists subsystem levels; POST {"touch": "debug"} changes them.
+// Levels are safe to set from here without going through the main loop.
+func handleLogLevels(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, logLevelMap())
+		return
+	}
+	var req map[string]string
+	if !requirePost(w, r, &req) {
+		return
+	}
+	for name, level := range req {
+		if err := setLogLevel(name, level); err != nil {
+			writeError(w, err)
+			return
+		}
+		logApp.Info("control: log level", "subsystem", name, "level", level)
+	}
+	writeJSON(w, http.StatusOK, logLevelMap())
+}
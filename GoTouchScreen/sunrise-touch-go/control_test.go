@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeleteMessage(t *testing.T) {
+	st := &appState{}
+	for i := 0; i < 3; i++ {
+		pushOverlay(st, overlay{markdown: "hi", dismissible: true})
+	}
+	s := &controlServer{cmds: make(chan controlCmd)}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case cmd := <-s.cmds:
+				v, err := cmd.run(&controlTarget{st: st})
+				cmd.resp <- controlReply{v, err}
+			case <-done:
+				return
+			}
+		}
+	}()
+	del := func(query string) int {
+		w := httptest.NewRecorder()
+		s.handleMessage(w, httptest.NewRequest(http.MethodDelete, "/api/message"+query, nil))
+		return w.Code
+	}
+
+	for _, q := range []string{"?id=abc", "?id=", "?id=0", "?id=-2"} {
+		if code := del(q); code != http.StatusBadRequest || len(st.overlays) != 3 {
+			t.Errorf("DELETE %s: %d, %d overlays left", q, code, len(st.overlays))
+		}
+	}
+	if code := del("?id=2"); code != http.StatusOK || len(st.overlays) != 2 || st.overlays[1].id != 3 {
+		t.Errorf("DELETE ?id=2: %d, overlays %+v", code, st.overlays)
+	}
+	if code := del(""); code != http.StatusOK || len(st.overlays) != 0 {
+		t.Errorf("DELETE all: %d, %d overlays left", code, len(st.overlays))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// exitArmWindow is how long the first EXIT tap waits for a confirming tap.
+const exitArmWindow = 5 * time.Second
+
+// Exit actions, selected by -exit-action or "exit_action" in the config.
+var exitActions = map[string]string{
+	"quit":     "quit",
+	"restart":  "restart app",
+	"reboot":   "reboot",
+	"poweroff": "power off",
+}
+
+func validateExitAction(action string) error {
+	if _, ok := exitActions[action]; !ok {
+		return fmt.Errorf("unknown exit action %q (want quit, restart, reboot or poweroff)", action)
+	}
+	return nil
+}
+
+// handleExitTap arms EXIT on the first tap and exits on a second tap inside
+// the arm window, so a stray touch in the corner can't kill the kiosk.
+func handleExitTap(st *appState) {
+	if !st.exitArmedUntil.IsZero() && time.Now().Before(st.exitArmedUntil) {
+		st.exitRequested = true
+		return
+	}
+	st.exitArmedUntil = time.Now().Add(exitArmWindow)
+	st.manualRedraw = true
+}
+
+// renderExitConfirm draws the confirmation strip under the header while EXIT
+// is armed.
+func renderExitConfirm(img *image.Gray, st appState, th uiTheme) {
+	if st.exitArmedUntil.IsZero() {
+		return
+	}
+	label, ok := exitActions[st.exitAction]
+	if !ok {
+		label = exitActions["quit"]
+	}
+	box := image.Rect(0, 23, 250, 41)
+	draw.Draw(img, box, &image.Uniform{color.Gray{Y: th.Foreground}}, image.Point{}, draw.Src)
+	text(img, 6, 36, "Tap EXIT! again to "+label, th.Background, th)
+}
+
+// exitPowerCommand is the systemctl call behind reboot and poweroff.
+// --no-block queues the job and returns, leaving systemd to stop the service
+// once the display is released. The service runs as an unprivileged User=,
+// so it goes through sudo -n unless this process is already root.
+func exitPowerCommand(action string) *exec.Cmd {
+	args := []string{"systemctl", "--no-block", action}
+	if os.Geteuid() != 0 {
+		args = append([]string{"sudo", "-n"}, args...)
+	}
+	return exec.Command(args[0], args[1:]...)
+}
+
+// checkExitAction reports whether this process may carry out action, so a
+// reboot or poweroff the user can't perform is caught at startup rather than
+// after the panel has been cleared. Non-root needs a sudoers entry such as
+//
+//	pi ALL=(root) NOPASSWD: /usr/bin/systemctl --no-block reboot, /usr/bin/systemctl --no-block poweroff
+func checkExitAction(action string) error {
+	if action != "reboot" && action != "poweroff" || os.Geteuid() == 0 {
+		return nil
+	}
+	if out, err := exec.Command("sudo", "-n", "-l", "systemctl", "--no-block", action).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s needs root or a passwordless sudoers entry for \"systemctl --no-block %s\": %v: %s", action, action, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// runExitAction performs the configured action once the panel has been
+// cleared and stats saved. release closes the display and touch buses; it
+// runs only once the action is committed, so on an error before that point
+// the caller still owns the hardware and can carry on.
+func runExitAction(action string, release func()) error {
+	switch action {
+	case "restart":
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("restart: %w", err)
+		}
+		logApp.Info("exit: restarting", "exe", exe)
+		release()
+		if err := syscall.Exec(exe, os.Args, os.Environ()); err != nil {
+			return fmt.Errorf("restart: %w", err)
+		}
+	case "reboot", "poweroff":
+		logApp.Info("exit: systemctl", "action", action)
+		if out, err := exitPowerCommand(action).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", action, err, out)
+		}
+		release()
+	default:
+		release()
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Flights page: aircraft decoded by a local dump1090 or readsb, read from its
+// aircraft.json (http://host/data/aircraft.json or /run/readsb/aircraft.json).
+
+// maxPositionAge drops aircraft whose last position is older than this.
+const maxPositionAge = 60 * time.Second
+
+// minFlightsEvery bounds the aircraft.json poll so a short -flights-every can't
+// hammer the decoder. It limits fetches only; how often the page redraws is
+// up to flightsPage.NextRefresh.
+const minFlightsEvery = 5 * time.Second
+
+type aircraftJSON struct {
+	Aircraft []struct {
+		Hex      string          `json:"hex"`
+		Flight   string          `json:"flight"`
+		AltBaro  json.RawMessage `json:"alt_baro"` // feet, or "ground"
+		Altitude json.RawMessage `json:"altitude"` // older dump1090
+		Lat      *float64        `json:"lat"`
+		Lon      *float64        `json:"lon"`
+		Track    *float64        `json:"track"`
+		SeenPos  float64         `json:"seen_pos"`
+	} `json:"aircraft"`
+}
+
+type aircraft struct {
+	callsign string
+	altFt    int
+	ground   bool
+	lat, lon float64
+	track    float64
+	hasTrack bool
+	distKm   float64 // filled in by nearest
+	bearing  float64
+}
+
+func parseAltitude(raw json.RawMessage) (ft int, ground, ok bool) {
+	if len(raw) == 0 {
+		return 0, false, false
+	}
+	var n float64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return int(n), false, true
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil && s == "ground" {
+		return 0, true, true
+	}
+	return 0, false, false
+}
+
+// parseAircraft keeps aircraft with a recent position; without a callsign the
+// ICAO hex address stands in.
+func parseAircraft(b []byte) ([]aircraft, error) {
+	var doc aircraftJSON
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("aircraft.json: %w", err)
+	}
+	var out []aircraft
+	for _, a := range doc.Aircraft {
+		if a.Lat == nil || a.Lon == nil || a.SeenPos > maxPositionAge.Seconds() {
+			continue
+		}
+		ac := aircraft{callsign: strings.TrimSpace(a.Flight), lat: *a.Lat, lon: *a.Lon}
+		if ac.callsign == "" {
+			ac.callsign = strings.ToUpper(strings.TrimPrefix(a.Hex, "~"))
+		}
+		alt := a.AltBaro
+		if len(alt) == 0 {
+			alt = a.Altitude
+		}
+		ac.altFt, ac.ground, _ = parseAltitude(alt)
+		if a.Track != nil {
+			ac.track, ac.hasTrack = *a.Track, true
+		}
+		out = append(out, ac)
+	}
+	return out, nil
+}
+
+// bearingDeg is the initial great-circle bearing from the first point to the
+// second, clockwise from true north.
+func bearingDeg(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2 := deg2rad(lat1), deg2rad(lat2)
+	dLon := deg2rad(lon2 - lon1)
+	y := math.Sin(dLon) * math.Cos(p2)
+	x := math.Cos(p1)*math.Sin(p2) - math.Sin(p1)*math.Cos(p2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+func compassPoint(deg float64) string {
+	points := [...]string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	return points[int(math.Round(deg/45))%8]
+}
+
+// flightService polls aircraft.json in the background, like weatherService;
+// the flights page redraws on the poll interval rather than on each fetch.
+type flightService struct {
+	source string
+	every  time.Duration
+	client *http.Client
+
+	mu      sync.Mutex
+	list    []aircraft
+	fetched time.Time
+	lastErr error
+}
+
+func newFlightService(source string, every time.Duration) *flightService {
+	return &flightService{
+		source: source,
+		every:  max(every, minFlightsEvery),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (f *flightService) run(ctx context.Context) {
+	tick := time.NewTicker(f.every)
+	defer tick.Stop()
+	for {
+		f.fetch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (f *flightService) fetch(ctx context.Context) {
+	b, err := f.read(ctx)
+	var list []aircraft
+	if err == nil {
+		list, err = parseAircraft(b)
+	}
+	f.mu.Lock()
+	f.lastErr = err
+	if err == nil {
+		f.list, f.fetched = list, time.Now()
+	}
+	f.mu.Unlock()
+	if err != nil {
+		logFlights.Warn("fetch failed", "err", err)
+	} else {
+		logFlights.Debug("fetched", "aircraft", len(list))
+	}
+}
+
+func (f *flightService) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(f.source, "http://") && !strings.HasPrefix(f.source, "https://") {
+		return os.ReadFile(f.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("aircraft.json: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+}
+
+// nearest returns up to n aircraft closest to lat/lon, whether the list is
+// stale (last fetch failed or missed three polls), and whether any fetch has
+// succeeded yet.
+func (f *flightService) nearest(now time.Time, lat, lon float64, n int) ([]aircraft, bool, bool) {
+	f.mu.Lock()
+	list := append([]aircraft(nil), f.list...)
+	stale := f.lastErr != nil || now.Sub(f.fetched) > 3*f.every
+	have := !f.fetched.IsZero()
+	f.mu.Unlock()
+	for i := range list {
+		list[i].distKm = haversineKm(lat, lon, list[i].lat, list[i].lon)
+		list[i].bearing = bearingDeg(lat, lon, list[i].lat, list[i].lon)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].distKm < list[j].distKm })
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list, stale, have
+}
+
+func (f *flightService) fetchedAt() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetched
+}
+
+func formatAltitude(a aircraft) string {
+	switch {
+	case a.ground:
+		return "GND"
+	case a.altFt >= 10000:
+		return fmt.Sprintf("%dk", (a.altFt+500)/1000)
+	default:
+		return fmt.Sprintf("%d", a.altFt)
+	}
+}
+
+func formatDistKm(km float64) string {
+	if km < 10 {
+		return fmt.Sprintf("%.1fkm", km)
+	}
+	return fmt.Sprintf("%.0fkm", km)
+}
+
+// radarRange rounds the farthest shown aircraft up to a readable ring scale.
+func radarRange(list []aircraft) float64 {
+	far := 0.0
+	for _, a := range list {
+		far = math.Max(far, a.distKm)
+	}
+	for _, r := range []float64{5, 10, 20, 50, 100, 200} {
+		if far <= r {
+			return r
+		}
+	}
+	return 400
+}
+
+// flightCell places list-view aircraft i: three in each column, two lines each.
+func flightCell(i int) (x, y int) {
+	if i < 3 {
+		return 6, 37 + i*29
+	}
+	return 132, 50 + (i-3)*24
+}
+
+const flightListRows = 6
+
+func renderFlightsPage(img *image.Gray, now time.Time, lat, lon float64, fs *flightService, n int, radar bool, th uiTheme) {
+	fg := th.Foreground
+	if fs == nil {
+		text(img, 8, 38, "FLIGHTS off", fg, th)
+		return
+	}
+	if !radar {
+		n = min(n, flightListRows)
+	}
+	list, stale, ok := fs.nearest(now, lat, lon, n)
+	switch {
+	case !ok:
+		text(img, 8, 38, "FLIGHTS", fg, th)
+		text(img, 8, 60, "waiting for", fg, th)
+		text(img, 8, 74, "aircraft.json", fg, th)
+		return
+	case stale:
+		// Inverted over the title, as on the weather page, so old positions
+		// can't pass for live ones.
+		fillRect(img, 126, 23, 249, 39, fg)
+		text(img, 132, 36, "STALE "+fs.fetchedAt().In(now.Location()).Format("15:04"), th.Background, th)
+	}
+	if len(list) == 0 {
+		text(img, 8, 38, "No aircraft", fg, th)
+		text(img, 8, 52, "in range.", fg, th)
+		return
+	}
+	if radar {
+		renderFlightRadar(img, list, th)
+		return
+	}
+	for i, a := range list {
+		x, y := flightCell(i)
+		text(img, x, y, fmt.Sprintf("%-8s %s", truncate(a.callsign, 8), formatAltitude(a)), fg, th)
+		text(img, x, y+12, fmt.Sprintf("%s %03.0f %s", formatDistKm(a.distKm), a.bearing, compassPoint(a.bearing)), fg, th)
+	}
+}
+
+// flightsPage toggles between the list and the radar on a body tap.
+type flightsPage struct {
+	pageDefaults
+	fs      *flightService
+	max     int
+	radar   bool
+	partial bool // partial refresh is on, so a change is worth a redraw
+
+	last    pageContext // context of the last draw
+	drawn   *image.Gray // the page as last drawn, for spotting changes
+	checked time.Time   // the fetch last compared against drawn
+	changed bool
+}
+
+func (*flightsPage) Title() string { return "flights" }
+
+func (p *flightsPage) Render(img *image.Gray, pc pageContext) {
+	renderFlightsPage(img, pc.now, pc.lat, pc.lon, p.fs, p.max, p.radar, pc.th)
+	p.last, p.drawn, p.changed = pc, p.snapshot(pc), false
+	if p.fs != nil {
+		p.checked = p.fs.fetchedAt()
+	}
+}
+
+// snapshot renders the page alone, to compare what a redraw would show with
+// what is on the panel.
+func (p *flightsPage) snapshot(pc pageContext) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 250, 122))
+	fillRect(img, 0, 0, 249, 121, pc.th.Background)
+	renderFlightsPage(img, pc.now, pc.lat, pc.lon, p.fs, p.max, p.radar, pc.th)
+	return img
+}
+
+func (p *flightsPage) HandleTouch(st *appState, x, y int) bool {
+	if y <= 28 {
+		return false
+	}
+	p.radar = !p.radar
+	st.manualRedraw = true
+	logTouch.Debug("flights: view", "radar", p.radar)
+	return true
+}
+
+// NextRefresh keeps the configured interval, except that with partial
+// refresh on, a poll that changes what the page shows is drawn at the poll
+// rate. Without partial refresh every redraw would be a full one, so the page
+// waits for the interval like the others.
+func (p *flightsPage) NextRefresh(last time.Time, every time.Duration) time.Time {
+	next := last.Add(every)
+	if p.fs == nil || !p.partial || p.drawn == nil {
+		return next
+	}
+	if f := p.fs.fetchedAt(); !f.Equal(p.checked) {
+		p.checked = f
+		pc := p.last
+		pc.now = time.Now().In(pc.now.Location())
+		p.changed = !bytes.Equal(p.snapshot(pc).Pix, p.drawn.Pix)
+	}
+	if soon := last.Add(p.fs.every); p.changed && soon.Before(next) {
+		return soon
+	}
+	return next
+}
+
+// renderFlightRadar plots bearing and distance around the home position in
+// the left column, north up; the right column names the nearest aircraft.
+func renderFlightRadar(img *image.Gray, list []aircraft, th uiTheme) {
+	fg := th.Foreground
+	const cx, cy, r = 62, 73, 46
+	rng := radarRange(list)
+	circle(img, cx, cy, r, fg, false)
+	circle(img, cx, cy, r/2, fg, false)
+	line(img, cx-2, cy, cx+2, cy, fg)
+	line(img, cx, cy-2, cx, cy+2, fg)
+	text(img, cx-3, cy-r+11, "N", fg, th)
+	for i, a := range list {
+		rad := deg2rad(a.bearing)
+		d := a.distKm / rng * r
+		x := cx + int(math.Round(d*math.Sin(rad)))
+		y := cy - int(math.Round(d*math.Cos(rad)))
+		circle(img, x, y, 2, fg, true)
+		if a.hasTrack {
+			t := deg2rad(a.track)
+			line(img, x, y, x+int(math.Round(7*math.Sin(t))), y-int(math.Round(7*math.Cos(t))), fg)
+		}
+		if i == 0 {
+			circle(img, x, y, 5, fg, false)
+		}
+	}
+
+	text(img, 132, 52, fmt.Sprintf("RANGE %.0fkm", rng), fg, th)
+	a := list[0]
+	text(img, 132, 72, "NEAREST "+a.callsign, fg, th)
+	text(img, 132, 86, "ALT "+formatAltitude(a), fg, th)
+	text(img, 132, 100, fmt.Sprintf("%s %03.0f %s", formatDistKm(a.distKm), a.bearing, compassPoint(a.bearing)), fg, th)
+	text(img, 132, 114, fmt.Sprintf("%d shown", len(list)), fg, th)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlightsNextRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(lat string) {
+		doc := `{"aircraft":[{"hex":"abc123","flight":"BAW1 ","alt_baro":35000,"lat":` + lat + `,"lon":-0.1,"seen_pos":1}]}`
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("51.6")
+	fs := newFlightService(path, 15*time.Second)
+	ctx := context.Background()
+	fs.fetch(ctx)
+
+	const every = 5 * time.Minute
+	for _, partial := range []bool{false, true} {
+		p := &flightsPage{fs: fs, max: 6, partial: partial}
+		last := time.Now()
+		pc := pageContext{now: last, lat: 51.5, lon: -0.1, th: builtinThemes()[0]}
+		p.Render(image.NewGray(image.Rect(0, 0, 250, 122)), pc)
+
+		time.Sleep(10 * time.Millisecond) // a new fetch time
+		fs.fetch(ctx)
+		if got := p.NextRefresh(last, every); !got.Equal(last.Add(every)) {
+			t.Errorf("partial=%v, unchanged poll: next in %v, want %v", partial, got.Sub(last), every)
+		}
+
+		write("51.9")
+		time.Sleep(10 * time.Millisecond)
+		fs.fetch(ctx)
+		want := last.Add(every)
+		if partial {
+			want = last.Add(fs.every)
+		}
+		if got := p.NextRefresh(last, every); !got.Equal(want) {
+			t.Errorf("partial=%v, changed poll: next in %v, want %v", partial, got.Sub(last), want.Sub(last))
+		}
+		write("51.6")
+		fs.fetch(ctx)
+	}
+}
+
+func TestParseAircraft(t *testing.T) {
+	list, err := parseAircraft([]byte(`{"aircraft":[
+		{"hex":"~a1","lat":51.6,"lon":-0.2,"alt_baro":"ground","seen_pos":2},
+		{"hex":"b2","flight":"EZY12","lat":51.7,"lon":-0.3,"altitude":12000,"track":90,"seen_pos":3},
+		{"hex":"c3","flight":"OLD","lat":51.7,"lon":-0.3,"seen_pos":120},
+		{"hex":"d4","flight":"NOPOS"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d aircraft, want 2", len(list))
+	}
+	if list[0].callsign != "A1" || !list[0].ground || formatAltitude(list[0]) != "GND" {
+		t.Errorf("first = %+v", list[0])
+	}
+	if list[1].callsign != "EZY12" || formatAltitude(list[1]) != "12k" || !list[1].hasTrack {
+		t.Errorf("second = %+v", list[1])
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Home page: Home Assistant entities as a grid of buttons. States come from
+// the REST API (GET /api/states) with a long-lived access token; tapping a
+// switchable entity calls its toggle (or press/turn_on) service.
+
+type haEntity struct {
+	ID         string `json:"entity_id"`
+	State      string `json:"state"`
+	Attributes struct {
+		FriendlyName string `json:"friendly_name"`
+		Unit         string `json:"unit_of_measurement"`
+	} `json:"attributes"`
+}
+
+func (e haEntity) name() string {
+	if e.Attributes.FriendlyName != "" {
+		return e.Attributes.FriendlyName
+	}
+	_, obj, _ := strings.Cut(e.ID, ".")
+	return obj
+}
+
+// haServiceFor is the service a tap calls, or "" for read-only domains.
+func haServiceFor(entityID string) string {
+	domain, _, _ := strings.Cut(entityID, ".")
+	switch domain {
+	case "light", "switch", "fan", "input_boolean", "automation", "cover", "media_player", "humidifier":
+		return "toggle"
+	case "script", "scene":
+		return "turn_on"
+	case "button", "input_button":
+		return "press"
+	}
+	return ""
+}
+
+// haStateText is the short value shown on a button.
+func haStateText(e haEntity) string {
+	switch e.State {
+	case "on", "off", "open", "closed", "playing", "paused", "idle":
+		return strings.ToUpper(e.State)
+	case "unavailable", "unknown", "":
+		return "n/a"
+	}
+	if f, err := strconv.ParseFloat(e.State, 64); err == nil {
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if len(s) > 6 {
+			s = fmt.Sprintf("%.1f", f)
+		}
+		return s + e.Attributes.Unit
+	}
+	if haServiceFor(e.ID) == "press" || strings.HasPrefix(e.ID, "scene.") {
+		// Their state is the last press time, not worth the space.
+		return ""
+	}
+	return e.State
+}
+
+type haService struct {
+	baseURL  string
+	token    string
+	entities []string
+	every    time.Duration
+	client   *http.Client
+	updated  chan struct{}
+	poke     chan struct{}
+
+	mu      sync.Mutex
+	states  map[string]haEntity
+	pending map[string]bool
+	fetched time.Time
+	lastErr error
+}
+
+func newHAService(baseURL, token string, entities []string, every time.Duration) *haService {
+	return &haService{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		token:    token,
+		entities: entities,
+		every:    every,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		updated:  make(chan struct{}, 1),
+		poke:     make(chan struct{}, 1),
+		states:   map[string]haEntity{},
+		pending:  map[string]bool{},
+	}
+}
+
+func (h *haService) do(ctx context.Context, method, path string, body any) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return b, nil
+}
+
+func (h *haService) run(ctx context.Context) {
+	for {
+		h.fetch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.poke:
+		case <-time.After(h.every):
+		}
+	}
+}
+
+func (h *haService) fetch(ctx context.Context) {
+	b, err := h.do(ctx, http.MethodGet, "/api/states", nil)
+	var all []haEntity
+	if err == nil {
+		err = json.Unmarshal(b, &all)
+	}
+	h.mu.Lock()
+	// Only a change in what the page shows is worth a panel refresh: an
+	// entity's state or attributes, a pending tap resolving, or the error
+	// marker coming or going.
+	changed := len(h.pending) > 0 || (err == nil) != (h.lastErr == nil) || h.fetched.IsZero()
+	h.lastErr = err
+	if err == nil {
+		// /api/states lists every entity; keep only the configured ones.
+		for _, e := range all {
+			if slices.Contains(h.entities, e.ID) {
+				if old, ok := h.states[e.ID]; !ok || old != e {
+					changed = true
+				}
+				h.states[e.ID] = e
+			}
+		}
+		h.fetched = time.Now()
+	}
+	clear(h.pending)
+	h.mu.Unlock()
+	if err != nil {
+		logHA.Warn("fetch failed", "err", err)
+	}
+	if changed {
+		h.signal()
+	}
+}
+
+func (h *haService) signal() {
+	select {
+	case h.updated <- struct{}{}:
+	default:
+	}
+}
+
+// call runs the entity's tap service in the background. The button shows as
+// pending until the next fetch, which follows shortly after the call so the
+// new state lands without waiting a whole interval; a failed or timed-out
+// call drops the pending mark straight away.
+func (h *haService) call(entityID string) {
+	service := haServiceFor(entityID)
+	if service == "" {
+		logHA.Debug("read-only entity", "entity", entityID)
+		return
+	}
+	h.mu.Lock()
+	h.pending[entityID] = true
+	h.mu.Unlock()
+	domain, _, _ := strings.Cut(entityID, ".")
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := h.do(ctx, http.MethodPost, "/api/services/"+domain+"/"+service, map[string]string{"entity_id": entityID})
+		if err != nil {
+			logHA.Warn("service call failed", "entity", entityID, "service", service, "err", err)
+			h.mu.Lock()
+			delete(h.pending, entityID)
+			h.mu.Unlock()
+			h.signal()
+			return
+		}
+		logHA.Info("service called", "entity", entityID, "service", service)
+		// Give HA a moment to apply the change before reading it back.
+		time.Sleep(time.Second)
+		select {
+		case h.poke <- struct{}{}:
+		default:
+		}
+	}()
+}
+
+func (h *haService) snapshot(ids []string) ([]haEntity, []bool, time.Time, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]haEntity, len(ids))
+	pending := make([]bool, len(ids))
+	for i, id := range ids {
+		e, ok := h.states[id]
+		if !ok {
+			e = haEntity{ID: id}
+		}
+		out[i], pending[i] = e, h.pending[id]
+	}
+	return out, pending, h.fetched, h.lastErr
+}
+
+const haPerPage = 6
+
+// haButtonRect is button i of a page: two columns of three under the header
+// strip.
+func haButtonRect(i int) rect {
+	x0 := 4
+	if i >= 3 {
+		x0 = 129
+	}
+	y0 := 40 + (i%3)*27
+	return rect{x0, y0, x0 + 116, y0 + 23}
+}
+
+var haPagerRect = rect{2, 23, 123, 38}
+
+func haPages(n int) int {
+	return max(1, (n+haPerPage-1)/haPerPage)
+}
+
+// haLabel fits name and state into a button, state right-aligned.
+func haLabel(name, state string, width int) string {
+	if state == "" {
+		return truncate(name, width)
+	}
+	n := utf8.RuneCountInString
+	room := width - n(state) - 1
+	if room < 3 {
+		return truncate(state, width)
+	}
+	name = truncate(name, room)
+	return name + strings.Repeat(" ", width-n(name)-n(state)) + state
+}
+
+// homePage shows the configured entities six at a time.
+type homePage struct {
+	pageDefaults
+	ha       *haService
+	entities []string
+	page     int
+}
+
+func (*homePage) Title() string { return "home" }
+
+func (p *homePage) Render(img *image.Gray, pc pageContext) {
+	renderHAPage(img, p.entities, p.page, p.ha, pc.th)
+}
+
+func renderHAPage(img *image.Gray, entities []string, page int, ha *haService, th uiTheme) {
+	fg := th.Foreground
+	if ha == nil {
+		text(img, 8, 38, "HOME off", fg, th)
+		return
+	}
+	pages := haPages(len(entities))
+	page %= pages
+	from := page * haPerPage
+	ids := entities[from:min(from+haPerPage, len(entities))]
+	ents, pending, fetched, err := ha.snapshot(ids)
+
+	head := "HOME"
+	if pages > 1 {
+		head = fmt.Sprintf("HOME %d/%d", page+1, pages)
+	}
+	text(img, 6, 35, head, fg, th)
+	switch {
+	case fetched.IsZero() && err != nil:
+		text(img, 8, 60, "HA unreachable", fg, th)
+		for i, l := range wrapText(err.Error(), 16) {
+			if i == 3 {
+				break
+			}
+			text(img, 8, 76+i*13, l, fg, th)
+		}
+		return
+	case fetched.IsZero():
+		text(img, 8, 60, "connecting...", fg, th)
+		return
+	case err != nil:
+		fillRect(img, 84, 25, 123, 37, fg)
+		text(img, 86, 35, "STALE", th.Background, th)
+	}
+	// Fit labels to the theme's (monospaced) button font.
+	adv, _ := th.face().GlyphAdvance('0')
+	chars := (haButtonRect(0).x1 - haButtonRect(0).x0 - 6) / max(1, adv.Round())
+	for i, e := range ents {
+		r := haButtonRect(i)
+		state := haStateText(e)
+		if pending[i] {
+			state = "..."
+		}
+		// Switched-on entities draw active, so the grid reads at a glance.
+		active := e.State == "on" || e.State == "open" || e.State == "playing"
+		drawButton(img, r, haLabel(e.name(), state, chars), active, th)
+	}
+}
+
+// HandleTouch calls the tapped entity's service (in the background), or
+// pages through the entities from the header strip.
+func (p *homePage) HandleTouch(st *appState, x, y int) bool {
+	if inside(haPagerRect, x, y) && len(p.entities) > haPerPage {
+		p.page = (p.page + 1) % haPages(len(p.entities))
+		st.manualRedraw = true
+		return true
+	}
+	from := (p.page % haPages(len(p.entities))) * haPerPage
+	for i := 0; i < haPerPage && from+i < len(p.entities); i++ {
+		if inside(haButtonRect(i), x, y) {
+			logTouch.Debug("home: tap", "entity", p.entities[from+i])
+			if p.ha != nil {
+				p.ha.call(p.entities[from+i])
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockHA is a stand-in Home Assistant: a few entities whose toggles stick,
+// behind the token "mock".
+type mockHA struct {
+	mu       sync.Mutex
+	states   map[string]*haEntity
+	failCall bool
+}
+
+func newMockHA(t *testing.T) (*mockHA, *httptest.Server) {
+	m := &mockHA{states: map[string]*haEntity{}}
+	add := func(id, state, name, unit string) {
+		e := &haEntity{ID: id, State: state}
+		e.Attributes.FriendlyName, e.Attributes.Unit = name, unit
+		m.states[id] = e
+	}
+	add("light.kitchen", "on", "Kitchen", "")
+	add("switch.fan", "off", "Fan", "")
+	add("sensor.living_temperature", "21.4", "Living temp", "°C")
+	add("binary_sensor.front_door", "off", "Front door", "")
+
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer mock" {
+				http.Error(w, "401: Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/states", auth(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		var all []haEntity
+		for _, e := range m.states {
+			all = append(all, *e)
+		}
+		json.NewEncoder(w).Encode(all)
+	}))
+	mux.HandleFunc("/api/services/", auth(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			EntityID string `json:"entity_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		e, ok := m.states[req.EntityID]
+		if r.Method != http.MethodPost || !ok || m.failCall {
+			http.Error(w, "500: Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/toggle") {
+			e.State = map[string]string{"on": "off", "off": "on"}[e.State]
+		}
+		json.NewEncoder(w).Encode([]haEntity{*e})
+	}))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func (m *mockHA) set(id, state string) {
+	m.mu.Lock()
+	m.states[id].State = state
+	m.mu.Unlock()
+}
+
+func signalled(h *haService) bool {
+	select {
+	case <-h.updated:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestHAFetchSignalsOnlyChanges(t *testing.T) {
+	m, srv := newMockHA(t)
+	ids := []string{"light.kitchen", "sensor.living_temperature"}
+	h := newHAService(srv.URL, "mock", ids, time.Minute)
+	ctx := context.Background()
+
+	h.fetch(ctx)
+	if !signalled(h) {
+		t.Fatal("first fetch not signalled")
+	}
+	ents, _, fetched, err := h.snapshot(ids)
+	if err != nil || fetched.IsZero() {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if len(h.states) != 2 || ents[0].State != "on" || haStateText(ents[1]) != "21.4°C" {
+		t.Fatalf("states = %+v", h.states)
+	}
+
+	h.fetch(ctx)
+	if signalled(h) {
+		t.Error("unchanged fetch signalled")
+	}
+	m.set("switch.fan", "on") // not watched
+	h.fetch(ctx)
+	if signalled(h) {
+		t.Error("unwatched entity change signalled")
+	}
+	m.set("sensor.living_temperature", "21.5")
+	h.fetch(ctx)
+	if !signalled(h) {
+		t.Error("watched entity change not signalled")
+	}
+}
+
+func TestHAFetchErrorClearsPending(t *testing.T) {
+	_, srv := newMockHA(t)
+	h := newHAService(srv.URL, "wrong", []string{"light.kitchen"}, time.Minute)
+	h.pending["light.kitchen"] = true
+	h.fetch(context.Background())
+	_, pending, _, err := h.snapshot([]string{"light.kitchen"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("err = %v, want 401", err)
+	}
+	if pending[0] {
+		t.Error("pending survived a failed fetch")
+	}
+	if !signalled(h) {
+		t.Error("error not signalled")
+	}
+}
+
+func TestHACall(t *testing.T) {
+	m, srv := newMockHA(t)
+	ids := []string{"light.kitchen"}
+	h := newHAService(srv.URL, "mock", ids, time.Minute)
+	h.fetch(context.Background())
+	signalled(h)
+
+	h.call("light.kitchen")
+	if _, pending, _, _ := h.snapshot(ids); !pending[0] {
+		t.Error("tap not pending")
+	}
+	select {
+	case <-h.poke:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no refetch after the call")
+	}
+	h.fetch(context.Background())
+	ents, pending, _, _ := h.snapshot(ids)
+	if ents[0].State != "off" || pending[0] {
+		t.Errorf("after toggle: state %q pending %v", ents[0].State, pending[0])
+	}
+
+	signalled(h)
+	m.mu.Lock()
+	m.failCall = true
+	m.mu.Unlock()
+	h.call("light.kitchen")
+	select {
+	case <-h.updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed call not signalled")
+	}
+	if _, pending, _, _ := h.snapshot(ids); pending[0] {
+		t.Error("pending survived a failed call")
+	}
+
+	h.call("binary_sensor.front_door") // read-only: no request
+	if len(h.pending) != 0 {
+		t.Error("read-only entity marked pending")
+	}
+}
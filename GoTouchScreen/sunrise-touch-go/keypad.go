@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+const (
+	keypadLat = iota
+	keypadLon
+)
+
+// keypadKeys are laid out in two rows of seven under the entry line, with
+// room above them for a validation error.
+var keypadKeys = [...]string{
+	"1", "2", "3", "4", "5", "6", "7",
+	"8", "9", "0", ".", "+/-", "<", "C",
+}
+
+const keypadMaxLen = 10
+
+func keypadKeyRect(i int) rect {
+	col, row := i%7, i/7
+	x0 := 4 + col*35
+	y0 := 40 + row*41
+	return rect{x0, y0, x0 + 32, y0 + 38}
+}
+
+func openKeypad(st *appState, target int) {
+	st.showKeypad = true
+	st.keypadTarget = target
+	st.keypadErr = ""
+	v := st.settingsLat
+	if target == keypadLon {
+		v = st.settingsLon
+	}
+	st.keypadBuf = strconv.FormatFloat(v, 'f', 4, 64)
+	st.manualRedraw = true
+}
+
+// keypadValue parses and range-checks the buffer for the keypad's target.
+func keypadValue(target int, buf string) (float64, error) {
+	v, err := strconv.ParseFloat(buf, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a number")
+	}
+	limit := 90.0
+	if target == keypadLon {
+		limit = 180
+	}
+	if v < -limit || v > limit {
+		return 0, fmt.Errorf("range -%g..%g", limit, limit)
+	}
+	return v, nil
+}
+
+func handleKeypadTouch(st *appState, x, y int) {
+	buttonCancel := rect{2, 0, 62, 28}
+	buttonOK := rect{187, 0, 249, 28}
+	st.manualRedraw = true
+
+	switch {
+	case inside(buttonCancel, x, y):
+		st.showKeypad = false
+		logTouch.Debug("keypad: CANCEL")
+		return
+	case inside(buttonOK, x, y):
+		v, err := keypadValue(st.keypadTarget, st.keypadBuf)
+		if err != nil {
+			st.keypadErr = err.Error()
+			logTouch.Info("keypad: rejected", "input", st.keypadBuf, "err", err)
+			return
+		}
+		if st.keypadTarget == keypadLon {
+			st.settingsLon = v
+		} else {
+			st.settingsLat = v
+		}
+		st.showKeypad = false
+		logTouch.Debug("keypad: OK", "value", v)
+		return
+	}
+
+	for i, k := range keypadKeys {
+		if !inside(keypadKeyRect(i), x, y) {
+			continue
+		}
+		st.keypadErr = ""
+		switch k {
+		case "<":
+			if st.keypadBuf != "" {
+				st.keypadBuf = st.keypadBuf[:len(st.keypadBuf)-1]
+			}
+		case "C":
+			st.keypadBuf = ""
+		case "+/-":
+			if strings.HasPrefix(st.keypadBuf, "-") {
+				st.keypadBuf = st.keypadBuf[1:]
+			} else {
+				st.keypadBuf = "-" + st.keypadBuf
+			}
+		case ".":
+			if !strings.Contains(st.keypadBuf, ".") && len(st.keypadBuf) < keypadMaxLen {
+				st.keypadBuf += "."
+			}
+		default:
+			if len(st.keypadBuf) < keypadMaxLen {
+				st.keypadBuf += k
+			}
+		}
+		return
+	}
+	st.manualRedraw = false
+}
+
+func renderKeypadView(img *image.Gray, st appState, th uiTheme) {
+	fg := th.Foreground
+	line(img, 0, 22, 249, 22, fg)
+	drawButton(img, rect{4, 2, 60, 20}, "CANCEL", false, th)
+	drawButton(img, rect{190, 2, 246, 20}, "OK", false, th)
+
+	label := "LAT"
+	if st.keypadTarget == keypadLon {
+		label = "LON"
+	}
+	text(img, 66, 16, label+" "+st.keypadBuf+"_", fg, th)
+	// The error gets its own line: in the entry it ran under OK.
+	if st.keypadErr != "" {
+		text(img, 4, 35, st.keypadErr, fg, th)
+	}
+
+	ink := fg
+	if th.ButtonStyle == "filled" {
+		ink = th.Background
+	}
+	for i, k := range keypadKeys {
+		r := keypadKeyRect(i)
+		drawButton(img, r, "", false, th)
+		// Centre the label; drawButton's fixed inset suits words, not keys.
+		w := len(k) * 7
+		textFace(img, r.x0+(r.x1-r.x0-w)/2+1, r.y0+24, k, ink, th.face())
+	}
+}
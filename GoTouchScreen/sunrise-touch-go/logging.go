@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Each subsystem logs through its own slog.Logger with its own level, so e.g.
+// touch can be turned up to debug without the rest of the journal following.
+// Levels are LevelVars and can be changed at runtime from any goroutine.
+
+var logSubsystems = []string{"app", "touch", "display", "config", "render", "weather", "calendar", "flights", "mqtt", "ha"}
+
+var (
+	logLevels   = map[string]*slog.LevelVar{}
+	logApp      = newSubsystemLogger("app")
+	logTouch    = newSubsystemLogger("touch")
+	logDisplay  = newSubsystemLogger("display")
+	logConfig   = newSubsystemLogger("config")
+	logRender   = newSubsystemLogger("render")
+	logWeather  = newSubsystemLogger("weather")
+	logCalendar = newSubsystemLogger("calendar")
+	logFlights  = newSubsystemLogger("flights")
+	logMQTT     = newSubsystemLogger("mqtt")
+	logHA       = newSubsystemLogger("ha")
+)
+
+// logOutput is swapped by setupLogging; subsystem loggers resolve it per
+// record so they can be created before flags are parsed.
+var logOutput struct {
+	sync.RWMutex
+	h slog.Handler
+}
+
+func init() {
+	logOutput.h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+}
+
+func newSubsystemLogger(name string) *slog.Logger {
+	lv := &slog.LevelVar{}
+	logLevels[name] = lv
+	return slog.New(levelHandler{level: lv}).With("subsystem", name)
+}
+
+// levelHandler filters by a subsystem level and forwards to logOutput. The
+// With and WithGroup calls made on it are kept in order and replayed onto the
+// output for each record, so attrs land in the groups open when they were
+// added.
+type levelHandler struct {
+	level slog.Leveler
+	ops   []handlerOp
+}
+
+// handlerOp is one WithGroup (group set) or WithAttrs call.
+type handlerOp struct {
+	group string
+	attrs []slog.Attr
+}
+
+func (h levelHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	logOutput.RLock()
+	out := logOutput.h
+	logOutput.RUnlock()
+	for _, op := range h.ops {
+		if op.group != "" {
+			out = out.WithGroup(op.group)
+		} else {
+			out = out.WithAttrs(op.attrs)
+		}
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h levelHandler) with(op handlerOp) levelHandler {
+	h.ops = append(h.ops[:len(h.ops):len(h.ops)], op)
+	return h
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(handlerOp{attrs: attrs})
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(handlerOp{group: name})
+}
+
+// setupLogging picks the output format ("text" or "json"), the default level,
+// and per-subsystem overrides such as "touch=debug,display=warn".
+func setupLogging(w io.Writer, format, level, overrides string) error {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	switch format {
+	case "", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("log format %q (want text or json)", format)
+	}
+	logOutput.Lock()
+	logOutput.h = h
+	logOutput.Unlock()
+
+	var def slog.Level
+	if err := def.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("log level %q: %w", level, err)
+	}
+	for _, lv := range logLevels {
+		lv.Set(def)
+	}
+	if overrides != "" {
+		for _, kv := range strings.Split(overrides, ",") {
+			name, lvl, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				return fmt.Errorf("log override %q (want subsystem=level)", kv)
+			}
+			if err := setLogLevel(name, lvl); err != nil {
+				return err
+			}
+		}
+	}
+	// Route the standard log package (and libraries using it) through app.
+	slog.SetDefault(logApp)
+	return nil
+}
+
+func setLogLevel(subsystem, level string) error {
+	lv, ok := logLevels[subsystem]
+	if !ok {
+		return fmt.Errorf("%w: unknown log subsystem %q (have %s)", errInvalidSetting, subsystem, strings.Join(logSubsystems, ", "))
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("%w: log level %q", errInvalidSetting, level)
+	}
+	lv.Set(l)
+	return nil
+}
+
+func logLevelMap() map[string]string {
+	out := map[string]string{}
+	for name, lv := range logLevels {
+		out[name] = lv.Level().String()
+	}
+	return out
+}
+
+// watchDebugSignal toggles every subsystem between debug and its configured
+// level on SIGUSR1, for when the control API is off.
+func watchDebugSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		var saved map[string]slog.Level
+		for range ch {
+			if saved == nil {
+				saved = map[string]slog.Level{}
+				for name, lv := range logLevels {
+					saved[name] = lv.Level()
+					lv.Set(slog.LevelDebug)
+				}
+				logApp.Info("debug logging on")
+				continue
+			}
+			for name, l := range saved {
+				logLevels[name].Set(l)
+			}
+			saved = nil
+			logApp.Info("debug logging off")
+		}
+	}()
+}
+
+// fatal logs at error level and exits, the slog counterpart of log.Fatal.
+func fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	os.Exit(1)
+}
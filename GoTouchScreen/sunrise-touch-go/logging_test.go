@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLevelHandlerGroups(t *testing.T) {
+	logOutput.RLock()
+	saved := logOutput.h
+	logOutput.RUnlock()
+	defer func() {
+		logOutput.Lock()
+		logOutput.h = saved
+		logOutput.Unlock()
+	}()
+	var buf bytes.Buffer
+	logOutput.Lock()
+	logOutput.h = slog.NewJSONHandler(&buf, nil)
+	logOutput.Unlock()
+
+	lv := &slog.LevelVar{}
+	l := slog.New(levelHandler{level: lv}).With("subsystem", "test")
+	l.WithGroup("req").With("id", 7).WithGroup("").WithGroup("resp").With("code", 200).Info("done", "ms", 12)
+	l.With("plain", true).Debug("filtered")
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	b, _ := json.Marshal(map[string]any{"subsystem": got["subsystem"], "req": got["req"]})
+	if want := `{"req":{"id":7,"resp":{"code":200,"ms":12}},"subsystem":"test"}`; string(b) != want {
+		t.Errorf("got %s\nwant %s", b, want)
+	}
+	if bytes.Count(buf.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("debug record not filtered at info:\n%s", buf.String())
+	}
+}
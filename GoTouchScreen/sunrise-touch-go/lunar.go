@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Lunar phase and rise/set. Phase and illumination follow Meeus, Astronomical
+// Algorithms ch. 48; new/full moon instants ch. 49 (main periodic terms only,
+// good to about a minute); rise/set uses a low-precision lunar position and an
+// hourly altitude scan with quadratic interpolation.
+
+// deltaT is TT-UT, close enough for this decade.
+const deltaT = 69 * time.Second
+
+const synodicMonth = 29.530588861
+
+type moonPhase struct {
+	// phase is the fraction of the synodic cycle: 0 new, 0.25 first quarter,
+	// 0.5 full, 0.75 last quarter.
+	phase        float64
+	illumination float64 // 0..1 of the disc lit
+	age          time.Duration
+}
+
+func julianCenturies(t time.Time) float64 {
+	return (julianDay(t.Add(deltaT)) - 2451545.0) / 36525.0
+}
+
+func moonPhaseAt(t time.Time) moonPhase {
+	tc := julianCenturies(t)
+	d := normalizeDeg(297.8501921 + 445267.1114034*tc - 0.0018819*tc*tc + tc*tc*tc/545868)
+	m := normalizeDeg(357.5291092 + 35999.0502909*tc - 0.0001536*tc*tc)
+	mp := normalizeDeg(134.9633964 + 477198.8675055*tc + 0.0087414*tc*tc + tc*tc*tc/69699)
+
+	dr, mr, mpr := deg2rad(d), deg2rad(m), deg2rad(mp)
+	i := 180 - d -
+		6.289*math.Sin(mpr) +
+		2.100*math.Sin(mr) -
+		1.274*math.Sin(2*dr-mpr) -
+		0.658*math.Sin(2*dr) -
+		0.214*math.Sin(2*mpr) -
+		0.110*math.Sin(dr)
+	illum := (1 + math.Cos(deg2rad(i))) / 2
+
+	// The phase angle i runs 180 (new) -> 0 (full) -> -180; map it back onto
+	// the elongation so phase increases monotonically over the cycle.
+	phase := normalizeDeg(180-i) / 360
+	return moonPhase{
+		phase:        phase,
+		illumination: illum,
+		age:          time.Duration(phase * synodicMonth * float64(24*time.Hour)),
+	}
+}
+
+func (p moonPhase) name() string {
+	switch f := p.phase; {
+	case f < 0.02 || f >= 0.98:
+		return "New moon"
+	case f < 0.23:
+		return "Waxing crescent"
+	case f < 0.27:
+		return "First quarter"
+	case f < 0.48:
+		return "Waxing gibbous"
+	case f < 0.52:
+		return "Full moon"
+	case f < 0.73:
+		return "Waning gibbous"
+	case f < 0.77:
+		return "Last quarter"
+	default:
+		return "Waning crescent"
+	}
+}
+
+// lunarPhaseInstant returns the instant of the new (frac 0) or full (frac 0.5)
+// moon for lunation k counted from the new moon of 2000-01-06.
+func lunarPhaseInstant(k float64, full bool) time.Time {
+	if full {
+		k += 0.5
+	}
+	t := k / 1236.85
+	jde := 2451550.09766 + synodicMonth*k + 0.00015437*t*t - 0.000000150*t*t*t + 0.00000000073*t*t*t*t
+	e := 1 - 0.002516*t - 0.0000074*t*t
+	m := deg2rad(2.5534 + 29.10535670*k - 0.0000014*t*t - 0.00000011*t*t*t)
+	mp := deg2rad(201.5643 + 385.81693528*k + 0.0107582*t*t + 0.00001238*t*t*t - 0.000000058*t*t*t*t)
+	f := deg2rad(160.7108 + 390.67050284*k - 0.0016118*t*t - 0.00000227*t*t*t + 0.000000011*t*t*t*t)
+	om := deg2rad(124.7746 - 1.56375588*k + 0.0020672*t*t + 0.00000215*t*t*t)
+
+	c := [...]float64{-0.40720, 0.17241, 0.01608, 0.01039, 0.00739, -0.00514, 0.00208}
+	if full {
+		c = [...]float64{-0.40614, 0.17302, 0.01614, 0.01043, 0.00734, -0.00515, 0.00209}
+	}
+	jde += c[0]*math.Sin(mp) +
+		c[1]*e*math.Sin(m) +
+		c[2]*math.Sin(2*mp) +
+		c[3]*math.Sin(2*f) +
+		c[4]*e*math.Sin(mp-m) +
+		c[5]*e*math.Sin(mp+m) +
+		c[6]*e*e*math.Sin(2*m) -
+		0.00111*math.Sin(mp-2*f) -
+		0.00057*math.Sin(mp+2*f) +
+		0.00056*e*math.Sin(2*mp+m) -
+		0.00042*math.Sin(3*mp) +
+		0.00042*e*math.Sin(m+2*f) +
+		0.00038*e*math.Sin(m-2*f) -
+		0.00024*e*math.Sin(2*mp-m) -
+		0.00017*math.Sin(om)
+
+	unixDays := jde - 2440587.5
+	return time.Unix(0, int64(unixDays*float64(24*time.Hour))).Add(-deltaT).UTC()
+}
+
+// nextLunarPhase returns the first new (full=false) or full moon after t.
+func nextLunarPhase(t time.Time, full bool) time.Time {
+	years := float64(t.Sub(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))) / float64(365.25*24*time.Hour)
+	k := math.Floor(years*12.3685) - 1
+	for {
+		at := lunarPhaseInstant(k, full)
+		if at.After(t) {
+			return at
+		}
+		k++
+	}
+}
+
+// moonEquatorial returns the moon's geocentric right ascension and declination
+// in radians from a low-precision series (about 0.3 deg).
+func moonEquatorial(t time.Time) (ra, dec float64) {
+	d := julianDay(t) - 2451545.0
+	l := deg2rad(218.316 + 13.176396*d)
+	m := deg2rad(134.963 + 13.064993*d)
+	f := deg2rad(93.272 + 13.229350*d)
+	lon := l + deg2rad(6.289)*math.Sin(m)
+	lat := deg2rad(5.128) * math.Sin(f)
+	e := deg2rad(23.4397)
+	ra = math.Atan2(math.Sin(lon)*math.Cos(e)-math.Tan(lat)*math.Sin(e), math.Cos(lon))
+	dec = math.Asin(math.Sin(lat)*math.Cos(e) + math.Cos(lat)*math.Sin(e)*math.Sin(lon))
+	return ra, dec
+}
+
+// moonAltitude is the apparent altitude of the moon's centre in degrees.
+func moonAltitude(t time.Time, lat, lon float64) float64 {
+	ra, dec := moonEquatorial(t)
+	d := julianDay(t) - 2451545.0
+	sidereal := deg2rad(280.16+360.9856235*d) + deg2rad(lon)
+	h := sidereal - ra
+	phi := deg2rad(lat)
+	alt := rad2deg(math.Asin(math.Sin(phi)*math.Sin(dec) + math.Cos(phi)*math.Cos(dec)*math.Cos(h)))
+	return alt + refraction(alt)
+}
+
+type moonTimes struct {
+	rise       time.Time
+	set        time.Time
+	alwaysUp   bool
+	alwaysDown bool
+}
+
+// moonTimesFor scans the local calendar day of day in loc for moonrise and
+// moonset. Either may be missing on a given day since the moon rises about
+// 50 minutes later each day.
+func moonTimesFor(day time.Time, lat, lon float64, loc *time.Location) moonTimes {
+	day = day.In(loc)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	// Horizon altitude of the centre allowing for parallax and semi-diameter.
+	const h0 = 0.133
+	alt := func(hours float64) float64 {
+		return moonAltitude(start.Add(time.Duration(hours*float64(time.Hour))), lat, lon) - h0
+	}
+	at := func(hours float64) time.Time {
+		return start.Add(time.Duration(hours * float64(time.Hour)))
+	}
+
+	var mt moonTimes
+	h0v := alt(0)
+	for i := 1.0; i <= 24; i += 2 {
+		h1 := alt(i)
+		h2 := alt(i + 1)
+		a := (h0v+h2)/2 - h1
+		b := (h2 - h0v) / 2
+		xe := -b / (2 * a)
+		ye := (a*xe+b)*xe + h1
+		dsc := b*b - 4*a*h1
+		roots := 0
+		var x1, x2 float64
+		if dsc >= 0 {
+			dx := math.Sqrt(dsc) / (math.Abs(a) * 2)
+			x1 = xe - dx
+			x2 = xe + dx
+			if math.Abs(x1) <= 1 {
+				roots++
+			}
+			if math.Abs(x2) <= 1 {
+				roots++
+			}
+			if x1 < -1 {
+				x1 = x2
+			}
+		}
+		switch roots {
+		case 1:
+			if h0v < 0 {
+				mt.rise = at(i + x1)
+			} else {
+				mt.set = at(i + x1)
+			}
+		case 2:
+			if ye < 0 {
+				mt.rise = at(i + x2)
+				mt.set = at(i + x1)
+			} else {
+				mt.rise = at(i + x1)
+				mt.set = at(i + x2)
+			}
+		}
+		if !mt.rise.IsZero() && !mt.set.IsZero() {
+			break
+		}
+		h0v = h2
+	}
+	if mt.rise.IsZero() && mt.set.IsZero() {
+		if h0v > 0 {
+			mt.alwaysUp = true
+		} else {
+			mt.alwaysDown = true
+		}
+	}
+	return mt
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Phase instants from the published lunar ephemeris (UTC, to the minute).
+func TestNextLunarPhase(t *testing.T) {
+	tests := []struct {
+		from string
+		full bool
+		want string
+	}{
+		{"2024-01-01 00:00", false, "2024-01-11 11:57"},
+		{"2024-01-01 00:00", true, "2024-01-25 17:54"},
+		{"2024-04-01 00:00", false, "2024-04-08 18:21"}, // the total solar eclipse
+		{"2024-09-01 00:00", true, "2024-09-18 02:34"},
+		{"2024-10-01 00:00", false, "2024-10-02 18:49"},
+		// Just after a phase, the next one is a month on.
+		{"2024-01-25 18:00", true, "2024-02-24 12:30"},
+	}
+	for _, tt := range tests {
+		from, _ := time.Parse("2006-01-02 15:04", tt.from)
+		want, _ := time.Parse("2006-01-02 15:04", tt.want)
+		got := nextLunarPhase(from, tt.full)
+		if d := got.Sub(want); d < -2*time.Minute || d > 2*time.Minute {
+			t.Errorf("nextLunarPhase(%s, full=%v) = %v, want %s", tt.from, tt.full, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+}
+
+func TestMoonTimesFor(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	const lat, lon = 51.5074, -0.1278
+	tests := []struct {
+		date          string
+		noRise, noSet bool
+	}{
+		{"2024-01-02", false, false},
+		// Rise slips past midnight after 23:05 on the 2nd: none on the 3rd.
+		{"2024-01-03", true, false},
+		{"2024-01-04", false, false},
+		// Likewise the set after 23:07 on the 16th.
+		{"2024-01-17", false, true},
+		{"2024-01-25", false, false},
+	}
+	for _, tt := range tests {
+		day, _ := time.ParseInLocation("2006-01-02", tt.date, loc)
+		m := moonTimesFor(day, lat, lon, loc)
+		if m.rise.IsZero() != tt.noRise || m.set.IsZero() != tt.noSet {
+			t.Errorf("%s: rise %v set %v, want none=%v/%v", tt.date, m.rise, m.set, tt.noRise, tt.noSet)
+			continue
+		}
+		for what, at := range map[string]time.Time{"rise": m.rise, "set": m.set} {
+			if at.IsZero() {
+				continue
+			}
+			if at.In(loc).Format("2006-01-02") != tt.date {
+				t.Errorf("%s: %s on %v, not that day", tt.date, what, at)
+			}
+			// The altitude is near the horizon and heading the right way.
+			before := moonAltitude(at.Add(-5*time.Minute), lat, lon)
+			after := moonAltitude(at.Add(5*time.Minute), lat, lon)
+			if (after > before) != (what == "rise") || math.Abs(moonAltitude(at, lat, lon)) > 1 {
+				t.Errorf("%s: %s at %v, altitude %.2f -> %.2f", tt.date, what, at, before, after)
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Prometheus text exposition, written by hand to keep the binary free of the
+// client library. Counters are per process; lifetime totals stay in stats.json.
+
+// refreshBuckets are upper bounds in seconds; a full refresh on the 2.13" panel
+// takes about two seconds, a partial well under one.
+var refreshBuckets = []float64{0.25, 0.5, 1, 2, 3, 5, 8, 13, 20}
+
+type histogram struct {
+	counts []int64 // per bucket, not cumulative
+	sum    float64
+	count  int64
+}
+
+type metrics struct {
+	mu            sync.Mutex
+	started       time.Time
+	refreshes     map[string]int64 // by mode
+	refreshErrors int64
+	refreshTime   map[string]*histogram
+	touches       int64
+	touchErrors   int64
+	panelSleeping bool
+	configResult  string // of the one config load, at startup
+	configSaves   map[string]int64
+}
+
+var appMetrics = newMetrics()
+
+func newMetrics() *metrics {
+	return &metrics{
+		started:     time.Now(),
+		refreshes:   map[string]int64{},
+		refreshTime: map[string]*histogram{},
+		configSaves: map[string]int64{},
+	}
+}
+
+func resultLabel(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, fs.ErrNotExist):
+		return "missing"
+	default:
+		return "error"
+	}
+}
+
+// observeRefresh records one display.Draw, whose duration includes the wait
+// for the panel's busy line.
+func (m *metrics) observeRefresh(full bool, d time.Duration, err error) {
+	mode := "partial"
+	if full {
+		mode = "full"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.refreshErrors++
+		return
+	}
+	m.refreshes[mode]++
+	h := m.refreshTime[mode]
+	if h == nil {
+		h = &histogram{counts: make([]int64, len(refreshBuckets))}
+		m.refreshTime[mode] = h
+	}
+	s := d.Seconds()
+	for i, b := range refreshBuckets {
+		if s <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+func (m *metrics) touch() {
+	m.mu.Lock()
+	m.touches++
+	m.mu.Unlock()
+}
+
+func (m *metrics) touchError() {
+	m.mu.Lock()
+	m.touchErrors++
+	m.mu.Unlock()
+}
+
+func (m *metrics) setSleeping(v bool) {
+	m.mu.Lock()
+	m.panelSleeping = v
+	m.mu.Unlock()
+}
+
+// configStartup records how the config load at startup went. Nothing
+// reloads it later; changes arrive through SET and the control API, which
+// count as saves.
+func (m *metrics) configStartup(err error) {
+	m.mu.Lock()
+	m.configResult = resultLabel(err)
+	m.mu.Unlock()
+}
+
+func (m *metrics) configSave(err error) {
+	m.mu.Lock()
+	m.configSaves[resultLabel(err)]++
+	m.mu.Unlock()
+}
+
+func writeLabeled(w io.Writer, name, help, typ, label string, vals map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, vals[k])
+	}
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeLabeled(w, "sunrise_refreshes_total", "Panel refreshes sent, by mode.", "counter", "mode", m.refreshes)
+	fmt.Fprintf(w, "# HELP sunrise_refresh_errors_total Panel refreshes that failed.\n# TYPE sunrise_refresh_errors_total counter\nsunrise_refresh_errors_total %d\n", m.refreshErrors)
+
+	fmt.Fprintf(w, "# HELP sunrise_refresh_duration_seconds Time from display.Draw through the busy wait.\n# TYPE sunrise_refresh_duration_seconds histogram\n")
+	modes := make([]string, 0, len(m.refreshTime))
+	for k := range m.refreshTime {
+		modes = append(modes, k)
+	}
+	sort.Strings(modes)
+	for _, mode := range modes {
+		h := m.refreshTime[mode]
+		var cum int64
+		for i, b := range refreshBuckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "sunrise_refresh_duration_seconds_bucket{mode=%q,le=\"%g\"} %d\n", mode, b, cum)
+		}
+		fmt.Fprintf(w, "sunrise_refresh_duration_seconds_bucket{mode=%q,le=\"+Inf\"} %d\n", mode, h.count)
+		fmt.Fprintf(w, "sunrise_refresh_duration_seconds_sum{mode=%q} %g\n", mode, h.sum)
+		fmt.Fprintf(w, "sunrise_refresh_duration_seconds_count{mode=%q} %d\n", mode, h.count)
+	}
+
+	fmt.Fprintf(w, "# HELP sunrise_touch_events_total Touches handled.\n# TYPE sunrise_touch_events_total counter\nsunrise_touch_events_total %d\n", m.touches)
+	fmt.Fprintf(w, "# HELP sunrise_touch_poll_errors_total Failed GT1151 polls.\n# TYPE sunrise_touch_poll_errors_total counter\nsunrise_touch_poll_errors_total %d\n", m.touchErrors)
+	sleeping := 0
+	if m.panelSleeping {
+		sleeping = 1
+	}
+	fmt.Fprintf(w, "# HELP sunrise_panel_sleeping Whether the panel controller is in deep sleep.\n# TYPE sunrise_panel_sleeping gauge\nsunrise_panel_sleeping %d\n", sleeping)
+	fmt.Fprintf(w, "# HELP sunrise_uptime_seconds Seconds since the process started.\n# TYPE sunrise_uptime_seconds gauge\nsunrise_uptime_seconds %.0f\n", time.Since(m.started).Seconds())
+	if m.configResult != "" {
+		writeLabeled(w, "sunrise_config_startup_load", "Result of loading the config file at startup.", "gauge", "result", map[string]int64{m.configResult: 1})
+	}
+	writeLabeled(w, "sunrise_config_saves_total", "Config file saves, by result.", "counter", "result", m.configSaves)
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// startMetricsServer serves only /metrics, for scraping from the network
+// without exposing the control API.
+func startMetricsServer(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", appMetrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logApp.Error("metrics server stopped", "err", err)
+		}
+	}()
+	logApp.Info("metrics listening", "addr", addr)
+	return srv, nil
+}
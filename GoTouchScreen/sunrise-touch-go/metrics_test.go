@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := newMetrics()
+	m.observeRefresh(true, 1500*time.Millisecond, nil)
+	m.observeRefresh(false, 300*time.Millisecond, nil)
+	m.observeRefresh(false, 400*time.Millisecond, nil)
+	m.observeRefresh(true, time.Second, errors.New("busy timeout"))
+	m.touch()
+	m.touchError()
+	m.setSleeping(true)
+	m.configStartup(fs.ErrNotExist)
+	m.configSave(nil)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	body := w.Body.String()
+
+	types := map[string]string{
+		"sunrise_refreshes_total":          "counter",
+		"sunrise_refresh_errors_total":     "counter",
+		"sunrise_refresh_duration_seconds": "histogram",
+		"sunrise_touch_events_total":       "counter",
+		"sunrise_touch_poll_errors_total":  "counter",
+		"sunrise_panel_sleeping":           "gauge",
+		"sunrise_uptime_seconds":           "gauge",
+		"sunrise_config_startup_load":      "gauge",
+		"sunrise_config_saves_total":       "counter",
+	}
+	// Every sample belongs to the family of the last TYPE line, which has a
+	// HELP line too.
+	declared := map[string]string{}
+	family := ""
+	for _, ln := range strings.Split(strings.TrimSpace(body), "\n") {
+		f := strings.Fields(ln)
+		switch {
+		case strings.HasPrefix(ln, "# HELP "):
+			if len(f) < 4 {
+				t.Errorf("HELP without text: %q", ln)
+			}
+		case strings.HasPrefix(ln, "# TYPE "):
+			family = f[2]
+			declared[family] = f[3]
+			if !strings.Contains(body, "# HELP "+family+" ") {
+				t.Errorf("%s has no HELP", family)
+			}
+		default:
+			name, _, _ := strings.Cut(f[0], "{")
+			if name != family && strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count") != family {
+				t.Errorf("sample %q outside its family %q", ln, family)
+			}
+		}
+	}
+	for name, typ := range types {
+		if declared[name] != typ {
+			t.Errorf("%s: TYPE %q, want %q", name, declared[name], typ)
+		}
+	}
+
+	for _, want := range []string{
+		`sunrise_refreshes_total{mode="full"} 1`,
+		`sunrise_refreshes_total{mode="partial"} 2`,
+		`sunrise_refresh_errors_total 1`,
+		// Buckets are cumulative: 1.5s lands in le=2, not le=1.
+		`sunrise_refresh_duration_seconds_bucket{mode="full",le="1"} 0`,
+		`sunrise_refresh_duration_seconds_bucket{mode="full",le="2"} 1`,
+		`sunrise_refresh_duration_seconds_bucket{mode="partial",le="0.25"} 0`,
+		`sunrise_refresh_duration_seconds_bucket{mode="partial",le="0.5"} 2`,
+		`sunrise_refresh_duration_seconds_bucket{mode="partial",le="+Inf"} 2`,
+		`sunrise_refresh_duration_seconds_sum{mode="partial"} 0.7`,
+		`sunrise_refresh_duration_seconds_count{mode="full"} 1`,
+		`sunrise_touch_events_total 1`,
+		`sunrise_touch_poll_errors_total 1`,
+		`sunrise_panel_sleeping 1`,
+		`sunrise_config_startup_load{result="missing"} 1`,
+		`sunrise_config_saves_total{result="ok"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
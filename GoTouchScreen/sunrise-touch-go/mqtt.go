@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal MQTT 3.1.1 client: QoS 0 publish and subscribe, retained state, a
+// last will for availability, and keepalive pings. That is all a Mosquitto or
+// Home Assistant broker needs from a dashboard, and it keeps the binary free
+// of a client library, as with the metrics exposition.
+//
+// Topics under the base (-mqtt-topic):
+//
+//	availability   online / offline (retained, offline is the last will)
+//	page, theme    current names (retained)
+//	sunrise        next sunrise, RFC 3339 (retained)
+//	touch          {"event_type":"touch","x":..,"y":..,"page":..} per tap
+//	cmd/page       page name, index or "next"
+//	cmd/theme      theme name or "next"
+//	cmd/message    text or markdown shown as a 5 minute overlay
+//	cmd/refresh    "full" or "partial" ("PRESS" from the HA button is full)
+
+const (
+	mqttKeepAlive  = 60 * time.Second
+	mqttMessageTTL = 5 * time.Minute
+)
+
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttSubscribe  = 0x82 // with the reserved flag bits set
+	mqttSuback     = 0x90
+	mqttPingreq    = 0xc0
+	mqttPingresp   = 0xd0
+	mqttDisconnect = 0xe0
+)
+
+// mqttConn is one broker session.
+type mqttConn struct {
+	c  net.Conn
+	r  *bufio.Reader
+	mu sync.Mutex // serialises writes
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// dialMQTT connects to mqtt://, tcp:// or mqtts:// URLs; credentials come
+// from the userinfo. will is published by the broker if the session drops.
+func dialMQTT(ctx context.Context, rawURL, clientID string, keepAlive time.Duration, will *mqttMessage) (*mqttConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: %w", err)
+	}
+	host := u.Host
+	var d net.Dialer
+	var c net.Conn
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+		c, err = d.DialContext(ctx, "tcp", host)
+	case "mqtts", "ssl", "tls":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: u.Hostname()}}
+		c, err = td.DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("mqtt: scheme %q (want mqtt, tcp or mqtts)", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: %w", err)
+	}
+
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendMQTTString(payload, clientID)
+	if will != nil {
+		flags |= 0x04
+		if will.retain {
+			flags |= 0x20
+		}
+		payload = appendMQTTString(payload, will.topic)
+		payload = appendMQTTString(payload, string(will.payload))
+	}
+	if u.User != nil {
+		flags |= 0x80
+		payload = appendMQTTString(payload, u.User.Username())
+		if pw, ok := u.User.Password(); ok {
+			flags |= 0x40
+			payload = appendMQTTString(payload, pw)
+		}
+	}
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 is 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive/time.Second))
+	body = append(body, payload...)
+
+	mc := &mqttConn{c: c, r: bufio.NewReader(c)}
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := mc.write(mqttConnect, body); err != nil {
+		c.Close()
+		return nil, err
+	}
+	typ, ack, err := mc.read()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if typ != mqttConnack || len(ack) < 2 {
+		c.Close()
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got %#x", typ)
+	}
+	if ack[1] != 0 {
+		c.Close()
+		return nil, fmt.Errorf("mqtt: connection refused (%s)", mqttConnackText(ack[1]))
+	}
+	c.SetDeadline(time.Time{})
+	return mc, nil
+}
+
+func mqttConnackText(code byte) string {
+	switch code {
+	case 1:
+		return "protocol version"
+	case 2:
+		return "client id rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorised"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func (m *mqttConn) write(typ byte, body []byte) error {
+	pkt := []byte{typ}
+	// Remaining length, seven bits per byte.
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	pkt = append(pkt, body...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := m.c.Write(pkt)
+	return err
+}
+
+func (m *mqttConn) read() (byte, []byte, error) {
+	typ, err := m.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		b, err := m.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		mult *= 128
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(m.r, body)
+	return typ, body, err
+}
+
+func (m *mqttConn) publish(msg mqttMessage) error {
+	typ := byte(mqttPublish)
+	if msg.retain {
+		typ |= 0x01
+	}
+	return m.write(typ, append(appendMQTTString(nil, msg.topic), msg.payload...))
+}
+
+// subscribe asks for QoS 0; the SUBACK arrives through read.
+func (m *mqttConn) subscribe(filter string) error {
+	body := []byte{0, 1} // packet id
+	body = appendMQTTString(body, filter)
+	return m.write(mqttSubscribe, append(body, 0))
+}
+
+// parsePublish splits an incoming PUBLISH, skipping the packet id a QoS 1 or
+// 2 delivery carries.
+func parsePublish(typ byte, body []byte) (mqttMessage, error) {
+	if len(body) < 2 {
+		return mqttMessage{}, errors.New("mqtt: short publish")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return mqttMessage{}, errors.New("mqtt: short publish topic")
+	}
+	msg := mqttMessage{topic: string(body[2 : 2+n]), retain: typ&0x01 != 0}
+	rest := body[2+n:]
+	if (typ>>1)&0x03 > 0 {
+		if len(rest) < 2 {
+			return mqttMessage{}, errors.New("mqtt: short publish id")
+		}
+		rest = rest[2:]
+	}
+	msg.payload = rest
+	return msg, nil
+}
+
+func (m *mqttConn) Close() error {
+	m.write(mqttDisconnect, nil)
+	return m.c.Close()
+}
+
+// mqttClient keeps a session up in the background, republishes retained
+// state after every reconnect, and turns cmd/ messages into controlCmds for
+// the main loop.
+type mqttClient struct {
+	url       string
+	base      string
+	discovery string // Home Assistant discovery prefix, empty to skip
+	clientID  string
+	keepAlive time.Duration
+	themes    []string
+	pages     []string
+	cmds      chan controlCmd
+	out       chan mqttMessage
+
+	mu       sync.Mutex
+	retained map[string][]byte
+}
+
+func newMQTTClient(rawURL, base, discovery string, themes []uiTheme, pages []string) *mqttClient {
+	host, _ := os.Hostname()
+	if base == "" {
+		base = "sunrise-touch/" + host
+	}
+	c := &mqttClient{
+		url:       rawURL,
+		base:      strings.TrimSuffix(base, "/"),
+		discovery: discovery,
+		clientID:  "sunrise-touch-" + host,
+		keepAlive: mqttKeepAlive,
+		cmds:      make(chan controlCmd),
+		out:       make(chan mqttMessage, 32),
+		retained:  map[string][]byte{},
+		pages:     pages,
+	}
+	for _, th := range themes {
+		c.themes = append(c.themes, th.Name)
+	}
+	return c
+}
+
+// publish queues a message under the base topic without blocking the main
+// loop; retained values are also kept for the next reconnect.
+func (c *mqttClient) publish(sub string, payload []byte, retain bool) {
+	msg := mqttMessage{topic: c.base + "/" + sub, payload: payload, retain: retain}
+	if retain {
+		c.mu.Lock()
+		if string(c.retained[msg.topic]) == string(payload) {
+			c.mu.Unlock()
+			return
+		}
+		c.retained[msg.topic] = payload
+		c.mu.Unlock()
+	}
+	select {
+	case c.out <- msg:
+	default:
+		logMQTT.Debug("publish dropped, queue full", "topic", msg.topic)
+	}
+}
+
+func (c *mqttClient) publishTouch(x, y int, page string) {
+	b, _ := json.Marshal(map[string]any{"event_type": "touch", "x": x, "y": y, "page": page})
+	c.publish("touch", b, false)
+}
+
+func (c *mqttClient) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logMQTT.Warn("session ended", "err", err, "retry", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func (c *mqttClient) session(ctx context.Context) error {
+	avail := c.base + "/availability"
+	conn, err := dialMQTT(ctx, c.url, c.clientID, c.keepAlive, &mqttMessage{topic: avail, payload: []byte("offline"), retain: true})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.subscribe(c.base + "/cmd/+"); err != nil {
+		return err
+	}
+	for _, msg := range c.discoveryConfigs() {
+		if err := conn.publish(msg); err != nil {
+			return err
+		}
+	}
+	// Anything queued while offline is either retained state, sent below, or
+	// a stale touch event.
+	for len(c.out) > 0 {
+		<-c.out
+	}
+	c.mu.Lock()
+	var state []mqttMessage
+	for topic, payload := range c.retained {
+		state = append(state, mqttMessage{topic: topic, payload: payload, retain: true})
+	}
+	c.mu.Unlock()
+	state = append(state, mqttMessage{topic: avail, payload: []byte("online"), retain: true})
+	for _, msg := range state {
+		if err := conn.publish(msg); err != nil {
+			return err
+		}
+	}
+	logMQTT.Info("connected", "base", c.base)
+
+	// Pings go out every half keepalive, so a live broker sends something,
+	// a PINGRESP at least, well inside the read deadline. Silence means a
+	// half-open connection (a Wi-Fi drop, say) that would otherwise never
+	// error, and state and commands would quietly stop.
+	readTimeout := c.keepAlive * 3 / 2
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			conn.c.SetReadDeadline(time.Now().Add(readTimeout))
+			typ, body, err := conn.read()
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = fmt.Errorf("mqtt: broker silent for %v, no PINGRESP", readTimeout)
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+			if typ&0xf0 != mqttPublish {
+				continue // SUBACK, PINGRESP
+			}
+			msg, err := parsePublish(typ, body)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			c.handleCommand(ctx, msg)
+		}
+	}()
+
+	ping := time.NewTicker(c.keepAlive / 2)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// A clean DISCONNECT suppresses the will, so say it ourselves.
+			conn.publish(mqttMessage{topic: avail, payload: []byte("offline"), retain: true})
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case msg := <-c.out:
+			if err := conn.publish(msg); err != nil {
+				return err
+			}
+		case <-ping.C:
+			if err := conn.write(mqttPingreq, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleCommand runs a cmd/ message on the main loop, like a control API
+// request, and logs rather than replies since MQTT has nowhere to answer.
+func (c *mqttClient) handleCommand(ctx context.Context, msg mqttMessage) {
+	name, ok := strings.CutPrefix(msg.topic, c.base+"/cmd/")
+	if !ok {
+		return
+	}
+	if msg.retain {
+		// A retained command would replay on every reconnect.
+		logMQTT.Warn("retained command ignored", "topic", msg.topic)
+		return
+	}
+	arg := strings.TrimSpace(string(msg.payload))
+	var fn func(t *controlTarget) (any, error)
+	switch name {
+	case "page":
+		fn = func(t *controlTarget) (any, error) { return nil, t.selectPage(arg) }
+	case "theme":
+		fn = func(t *controlTarget) (any, error) { return nil, t.selectTheme(arg) }
+	case "refresh":
+		if arg == "PRESS" {
+			arg = "full"
+		}
+		fn = func(t *controlTarget) (any, error) { return nil, t.queueRefresh(arg) }
+	case "message":
+		if arg == "" {
+			fn = func(t *controlTarget) (any, error) {
+				removeOverlays(t.st, func(overlay) bool { return false })
+				return nil, nil
+			}
+			break
+		}
+		o := overlay{dismissible: true, expires: time.Now().Add(mqttMessageTTL), markdown: string(msg.payload)}
+		fn = func(t *controlTarget) (any, error) {
+			id := pushOverlay(t.st, o)
+			logApp.Info("mqtt: message", "id", id)
+			return nil, nil
+		}
+	default:
+		logMQTT.Warn("unknown command", "topic", msg.topic)
+		return
+	}
+	cctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	cmd := controlCmd{run: fn, resp: make(chan controlReply, 1)}
+	select {
+	case c.cmds <- cmd:
+	case <-cctx.Done():
+		logMQTT.Warn("command dropped, main loop busy", "cmd", name)
+		return
+	}
+	select {
+	case rep := <-cmd.resp:
+		if rep.err != nil {
+			logMQTT.Warn("command failed", "cmd", name, "err", rep.err)
+		}
+	case <-cctx.Done():
+	}
+}
+
+var haObjectID = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// discoveryConfigs describes the dashboard to Home Assistant as one device
+// with a page and theme select, a refresh button, a message text box, the
+// next sunrise and a touch event.
+func (c *mqttClient) discoveryConfigs() []mqttMessage {
+	if c.discovery == "" {
+		return nil
+	}
+	node := haObjectID.ReplaceAllString(c.clientID, "_")
+	device := map[string]any{
+		"identifiers":  []string{node},
+		"name":         "Sunrise Touch " + strings.TrimPrefix(c.clientID, "sunrise-touch-"),
+		"model":        "2.13in e-paper touch HAT",
+		"manufacturer": "sunrise-touch-go",
+	}
+	entity := func(component, object string, cfg map[string]any) mqttMessage {
+		cfg["unique_id"] = node + "_" + object
+		cfg["object_id"] = node + "_" + object
+		cfg["availability_topic"] = c.base + "/availability"
+		cfg["device"] = device
+		b, _ := json.Marshal(cfg)
+		return mqttMessage{topic: fmt.Sprintf("%s/%s/%s/%s/config", c.discovery, component, node, object), payload: b, retain: true}
+	}
+	return []mqttMessage{
+		entity("sensor", "sunrise", map[string]any{
+			"name":         "Next sunrise",
+			"state_topic":  c.base + "/sunrise",
+			"device_class": "timestamp",
+			"icon":         "mdi:weather-sunset-up",
+		}),
+		entity("select", "page", map[string]any{
+			"name":          "Page",
+			"state_topic":   c.base + "/page",
+			"command_topic": c.base + "/cmd/page",
+			"options":       c.pages,
+		}),
+		entity("select", "theme", map[string]any{
+			"name":          "Theme",
+			"state_topic":   c.base + "/theme",
+			"command_topic": c.base + "/cmd/theme",
+			"options":       c.themes,
+		}),
+		entity("button", "refresh", map[string]any{
+			"name":          "Full refresh",
+			"command_topic": c.base + "/cmd/refresh",
+		}),
+		entity("text", "message", map[string]any{
+			"name":          "Message",
+			"command_topic": c.base + "/cmd/message",
+			"max":           255,
+		}),
+		entity("event", "touch", map[string]any{
+			"name":        "Touch",
+			"state_topic": c.base + "/touch",
+			"event_types": []string{"touch"},
+		}),
+	}
+}
+
+// mqttCheck round-trips a message through the broker on the client's own
+// check topic, to test the connection and credentials against a local broker
+// before pointing the dashboard at it.
+func mqttCheck(rawURL, base string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := newMQTTClient(rawURL, base, "", nil, nil)
+	conn, err := dialMQTT(ctx, rawURL, c.clientID+"-check", c.keepAlive, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	topic := c.base + "/check"
+	if err := conn.subscribe(topic); err != nil {
+		return err
+	}
+	token := fmt.Sprintf("%d", time.Now().UnixNano())
+	start := time.Now()
+	if err := conn.publish(mqttMessage{topic: topic, payload: []byte(token)}); err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.c.SetReadDeadline(deadline)
+	for {
+		typ, body, err := conn.read()
+		if err != nil {
+			return fmt.Errorf("mqtt: no echo on %s: %w", topic, err)
+		}
+		if typ&0xf0 != mqttPublish {
+			continue
+		}
+		if msg, err := parsePublish(typ, body); err == nil && string(msg.payload) == token {
+			fmt.Printf("ok: round trip on %s in %v\n", topic, time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeBroker is just enough MQTT 3.1.1 server for the client: it acks
+// CONNECT and SUBSCRIBE, answers PINGREQ unless mute, and records what it
+// is sent.
+type fakeBroker struct {
+	ln   net.Listener
+	mute atomic.Bool // stop answering, as a half-open connection would
+
+	mu        sync.Mutex
+	connects  []fakeConnect
+	subs      []string
+	published []mqttMessage
+	conn      *mqttConn // latest session
+	events    chan string
+}
+
+type fakeConnect struct {
+	clientID, user, password string
+	will                     mqttMessage
+	keepAlive                int
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, events: make(chan string, 256)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(&mqttConn{c: c, r: bufio.NewReader(c)})
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) url() string { return "mqtt://dash:secret@" + b.ln.Addr().String() }
+
+func readMQTTString(p []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(p))
+	return string(p[2 : 2+n]), p[2+n:]
+}
+
+func (b *fakeBroker) serve(mc *mqttConn) {
+	defer mc.c.Close()
+	for {
+		typ, body, err := mc.read()
+		if err != nil {
+			return
+		}
+		switch typ & 0xf0 {
+		case mqttConnect:
+			_, rest := readMQTTString(body) // "MQTT"
+			flags := rest[1]
+			fc := fakeConnect{keepAlive: int(binary.BigEndian.Uint16(rest[2:]))}
+			rest = rest[4:]
+			fc.clientID, rest = readMQTTString(rest)
+			if flags&0x04 != 0 {
+				var payload string
+				fc.will.topic, rest = readMQTTString(rest)
+				payload, rest = readMQTTString(rest)
+				fc.will.payload, fc.will.retain = []byte(payload), flags&0x20 != 0
+			}
+			if flags&0x80 != 0 {
+				fc.user, rest = readMQTTString(rest)
+			}
+			if flags&0x40 != 0 {
+				fc.password, _ = readMQTTString(rest)
+			}
+			b.mu.Lock()
+			b.connects = append(b.connects, fc)
+			b.conn = mc
+			b.mu.Unlock()
+			b.mute.Store(false)
+			mc.write(mqttConnack, []byte{0, 0})
+			b.events <- "connect"
+		case mqttSubscribe & 0xf0:
+			filter, _ := readMQTTString(body[2:])
+			b.mu.Lock()
+			b.subs = append(b.subs, filter)
+			b.mu.Unlock()
+			mc.write(mqttSuback, []byte{body[0], body[1], 0})
+			b.events <- "subscribe"
+		case mqttPublish:
+			msg, err := parsePublish(typ, body)
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.published = append(b.published, msg)
+			b.mu.Unlock()
+			b.events <- "publish " + msg.topic + " " + string(msg.payload)
+		case mqttPingreq:
+			if !b.mute.Load() {
+				mc.write(mqttPingresp, nil)
+			}
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+// send publishes to the client over the latest session.
+func (b *fakeBroker) send(msg mqttMessage) error {
+	b.mu.Lock()
+	mc := b.conn
+	b.mu.Unlock()
+	return mc.publish(msg)
+}
+
+// waitFor reads broker events until one has the prefix.
+func (b *fakeBroker) waitFor(t *testing.T, prefix string, within time.Duration) string {
+	t.Helper()
+	timeout := time.After(within)
+	for {
+		select {
+		case ev := <-b.events:
+			if strings.HasPrefix(ev, prefix) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no %q from the client within %v", prefix, within)
+			return ""
+		}
+	}
+}
+
+func TestMQTTClient(t *testing.T) {
+	b := newFakeBroker(t)
+	c := newMQTTClient(b.url(), "test/dash", "homeassistant", builtinThemes(), []string{"sunrise", "stats"})
+	c.keepAlive = time.Second
+	c.publish("page", []byte("sunrise"), true) // queued before connecting
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.run(ctx)
+
+	// CONNECT carries the credentials, keepalive and an offline will.
+	b.waitFor(t, "connect", 5*time.Second)
+	b.mu.Lock()
+	fc := b.connects[0]
+	b.mu.Unlock()
+	if fc.user != "dash" || fc.password != "secret" || fc.keepAlive != 1 || !strings.HasPrefix(fc.clientID, "sunrise-touch-") {
+		t.Errorf("connect = %+v", fc)
+	}
+	if fc.will.topic != "test/dash/availability" || string(fc.will.payload) != "offline" || !fc.will.retain {
+		t.Errorf("will = %+v", fc.will)
+	}
+
+	// SUBSCRIBE, retained discovery, then retained state and "online".
+	b.waitFor(t, "subscribe", time.Second)
+	b.waitFor(t, "publish test/dash/availability online", 2*time.Second)
+	b.mu.Lock()
+	if len(b.subs) != 1 || b.subs[0] != "test/dash/cmd/+" {
+		t.Errorf("subscriptions = %v", b.subs)
+	}
+	discovery, page := 0, 0
+	for _, m := range b.published {
+		if strings.HasPrefix(m.topic, "homeassistant/") && strings.HasSuffix(m.topic, "/config") && m.retain {
+			discovery++
+			if strings.HasPrefix(m.topic, "homeassistant/select/") && strings.HasSuffix(m.topic, "/page/config") {
+				var cfg struct {
+					Options []string `json:"options"`
+				}
+				json.Unmarshal(m.payload, &cfg)
+				if strings.Join(cfg.Options, ",") != "sunrise,stats" {
+					t.Errorf("page options = %v", cfg.Options)
+				}
+			}
+		}
+		if m.topic == "test/dash/page" && string(m.payload) == "sunrise" && m.retain {
+			page++
+		}
+	}
+	b.mu.Unlock()
+	if discovery != 6 {
+		t.Errorf("%d retained discovery configs, want 6", discovery)
+	}
+	if page != 1 {
+		t.Errorf("retained page state sent %d times, want once", page)
+	}
+
+	// Outgoing state while connected.
+	c.publish("theme", []byte("Dark"), true)
+	b.waitFor(t, "publish test/dash/theme Dark", time.Second)
+
+	// A command becomes a controlCmd for the main loop; a retained one is
+	// ignored.
+	st := appState{pages: []Page{sunrisePage{}, statsPage{}}}
+	if err := b.send(mqttMessage{topic: "test/dash/cmd/page", payload: []byte("stats"), retain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.send(mqttMessage{topic: "test/dash/cmd/page", payload: []byte("stats")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cmd := <-c.cmds:
+		v, err := cmd.run(&controlTarget{st: &st})
+		cmd.resp <- controlReply{v, err}
+		if err != nil || st.currentPage().Title() != "stats" {
+			t.Errorf("page command: err %v, page %s", err, st.currentPage().Title())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("page command not delivered")
+	}
+	select {
+	case <-c.cmds:
+		t.Error("retained command delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The broker goes quiet without closing the connection: the missing
+	// PINGRESP ends the session and the client reconnects, republishing its
+	// retained state.
+	b.mute.Store(true)
+	b.waitFor(t, "connect", 6*time.Second)
+	b.waitFor(t, "publish test/dash/theme Dark", 2*time.Second)
+	b.waitFor(t, "publish test/dash/availability online", 2*time.Second)
+
+	// Shutting down says offline itself, since a clean DISCONNECT drops the
+	// will.
+	cancel()
+	b.waitFor(t, "publish test/dash/availability offline", 2*time.Second)
+}
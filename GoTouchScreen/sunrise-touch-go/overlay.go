@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/bmp"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font/inconsolata"
+)
+
+// Overlays are pushed messages (an image or a short markdown note) shown over
+// the dashboard until their TTL runs out or someone taps them away. They are
+// drawn into the normal landscape frame, so they go through the same 1-bit
+// conversion and partial-diff refresh as the built-in pages.
+
+const maxOverlays = 16
+
+// maxOverlayScale bounds pushed images to this multiple of the 250x122 frame.
+// A few KB of PNG can declare a huge canvas, so the header is checked before
+// anything is decoded.
+const maxOverlayScale = 8
+
+type overlay struct {
+	id          int
+	priority    int
+	expires     time.Time // zero means until dismissed
+	dismissible bool
+	img         *image.Gray // fitted and dithered; nil for text
+	markdown    string
+}
+
+// activeOverlay picks the highest priority overlay, newest first on ties.
+func (st appState) activeOverlay() int {
+	best := -1
+	for i, o := range st.overlays {
+		if best < 0 || o.priority > st.overlays[best].priority ||
+			(o.priority == st.overlays[best].priority && o.id > st.overlays[best].id) {
+			best = i
+		}
+	}
+	return best
+}
+
+func pushOverlay(st *appState, o overlay) int {
+	st.overlaySeq++
+	o.id = st.overlaySeq
+	if len(st.overlays) >= maxOverlays {
+		// Make room by dropping the lowest priority, oldest entry.
+		drop := 0
+		for i, x := range st.overlays {
+			if x.priority < st.overlays[drop].priority {
+				drop = i
+			}
+		}
+		st.overlays = append(st.overlays[:drop], st.overlays[drop+1:]...)
+	}
+	st.overlays = append(st.overlays, o)
+	st.manualRedraw = true
+	return o.id
+}
+
+// removeOverlays drops overlays matching keep==false and reports whether any
+// went.
+func removeOverlays(st *appState, keep func(o overlay) bool) bool {
+	n := 0
+	for _, o := range st.overlays {
+		if keep(o) {
+			st.overlays[n] = o
+			n++
+		}
+	}
+	changed := n != len(st.overlays)
+	st.overlays = st.overlays[:n]
+	if changed {
+		st.manualRedraw = true
+	}
+	return changed
+}
+
+func expireOverlays(st *appState, now time.Time) bool {
+	return removeOverlays(st, func(o overlay) bool {
+		return o.expires.IsZero() || now.Before(o.expires)
+	})
+}
+
+// handleOverlayTouch dismisses the visible overlay. Touches never fall
+// through to the hidden UI underneath.
+func handleOverlayTouch(st *appState) {
+	i := st.activeOverlay()
+	if !st.overlays[i].dismissible {
+		logTouch.Debug("overlay not dismissible", "id", st.overlays[i].id)
+		return
+	}
+	id := st.overlays[i].id
+	removeOverlays(st, func(o overlay) bool { return o.id != id })
+	logTouch.Info("overlay dismissed", "id", id)
+}
+
+// fitImage scales src to fit the landscape frame and Floyd-Steinberg dithers
+// it, so photos survive the panel's 1-bit threshold.
+func fitImage(src image.Image) *image.Gray {
+	const w, h = 250, 122
+	sb := src.Bounds()
+	scale := min(float64(w)/float64(sb.Dx()), float64(h)/float64(sb.Dy()))
+	dw, dh := max(1, int(float64(sb.Dx())*scale)), max(1, int(float64(sb.Dy())*scale))
+	at := image.Rect((w-dw)/2, (h-dh)/2, (w-dw)/2+dw, (h-dh)/2+dh)
+
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	draw.Draw(gray, gray.Bounds(), image.White, image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(gray, at, src, sb, xdraw.Over, nil)
+
+	pal := image.NewPaletted(gray.Bounds(), color.Palette{color.Black, color.White})
+	draw.FloydSteinberg.Draw(pal, pal.Bounds(), gray, image.Point{})
+	draw.Draw(gray, gray.Bounds(), pal, image.Point{}, draw.Src)
+	return gray
+}
+
+// wrapText breaks s into lines of at most width characters.
+func wrapText(s string, width int) []string {
+	var out []string
+	cur := ""
+	for _, word := range strings.Fields(s) {
+		for len(word) > width {
+			if cur != "" {
+				out = append(out, cur)
+				cur = ""
+			}
+			out = append(out, word[:width])
+			word = word[width:]
+		}
+		switch {
+		case cur == "":
+			cur = word
+		case len(cur)+1+len(word) <= width:
+			cur += " " + word
+		default:
+			out = append(out, cur)
+			cur = word
+		}
+	}
+	if cur != "" {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// renderOverlay draws o over the whole frame. Text supports a small markdown
+// subset: a leading "# " heading, "- "/"* " bullets and ** / ` emphasis,
+// which is simply dropped.
+func renderOverlay(img *image.Gray, o overlay, now time.Time, th uiTheme) {
+	if o.img != nil {
+		draw.Draw(img, img.Bounds(), o.img, image.Point{}, draw.Src)
+		return
+	}
+	bg, fg := th.Background, th.Foreground
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: bg}}, image.Point{}, draw.Src)
+
+	body := strings.NewReplacer("**", "", "__", "", "`", "").Replace(o.markdown)
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	y := 14
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "#") {
+		title := strings.TrimSpace(strings.TrimLeft(lines[0], "#"))
+		for i, l := range wrapText(title, 30) {
+			if i == 2 {
+				break
+			}
+			textFace(img, 4, y+2, l, fg, inconsolata.Bold8x16)
+			y += 17
+		}
+		line(img, 0, y-8, 249, y-8, fg)
+		y += 6
+		lines = lines[1:]
+	}
+	var wrapped []string
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "- ") || strings.HasPrefix(l, "* ") {
+			for i, wl := range wrapText(l[2:], 33) {
+				if i == 0 {
+					wrapped = append(wrapped, "- "+wl)
+				} else {
+					wrapped = append(wrapped, "  "+wl)
+				}
+			}
+			continue
+		}
+		wrapped = append(wrapped, wrapText(l, 35)...)
+	}
+	const footerY = 118
+	for i, l := range wrapped {
+		if y+13 > footerY-4 && i < len(wrapped)-1 {
+			text(img, 4, y, fmt.Sprintf("... +%d lines", len(wrapped)-i), fg, th)
+			break
+		}
+		text(img, 4, y, l, fg, th)
+		y += 12
+	}
+
+	footer := ""
+	if o.dismissible {
+		footer = "tap to dismiss"
+	}
+	if !o.expires.IsZero() {
+		// The panel only redraws on change, so show an end time rather
+		// than a countdown that would go stale.
+		footer = strings.TrimSpace(footer + "  until " + o.expires.In(now.Location()).Format("15:04"))
+	}
+	if footer != "" {
+		text(img, 249-len(footer)*7, footerY, footer, fg, th)
+	}
+}
+
+// parseOverlay builds an overlay from a POST /api/message request. The body is
+// an image (image/png, image/bmp) or text (text/plain, text/markdown); ttl
+// (default 5m, 0 keeps it until tapped), priority and dismiss come from the
+// query string.
+func parseOverlay(r *http.Request) (overlay, error) {
+	q := r.URL.Query()
+	o := overlay{dismissible: true}
+	ttl := 5 * time.Minute
+	if v := q.Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			if secs, err2 := strconv.Atoi(v); err2 == nil {
+				d = time.Duration(secs) * time.Second
+			} else {
+				return o, fmt.Errorf("%w: ttl %q", errInvalidSetting, v)
+			}
+		}
+		if d < 0 || d > 24*time.Hour {
+			return o, fmt.Errorf("%w: ttl %v outside 0..24h", errInvalidSetting, d)
+		}
+		ttl = d
+	}
+	if v := q.Get("priority"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return o, fmt.Errorf("%w: priority %q", errInvalidSetting, v)
+		}
+		o.priority = p
+	}
+	if v := q.Get("dismiss"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("%w: dismiss %q", errInvalidSetting, v)
+		}
+		o.dismissible = b
+	}
+	if ttl == 0 && !o.dismissible {
+		return o, fmt.Errorf("%w: a message without ttl must be dismissible", errInvalidSetting)
+	}
+	if ttl > 0 {
+		o.expires = time.Now().Add(ttl)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4<<20+1))
+	if err != nil {
+		return o, err
+	}
+	if len(body) > 4<<20 {
+		return o, fmt.Errorf("%w: body over 4MB", errInvalidSetting)
+	}
+	ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ctype {
+	case "image/png", "image/bmp", "image/x-bmp":
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(body))
+		if err != nil {
+			return o, fmt.Errorf("%w: image: %v", errInvalidSetting, err)
+		}
+		if cfg.Width > 250*maxOverlayScale || cfg.Height > 122*maxOverlayScale {
+			return o, fmt.Errorf("%w: image %dx%d larger than %dx%d", errInvalidSetting,
+				cfg.Width, cfg.Height, 250*maxOverlayScale, 122*maxOverlayScale)
+		}
+		src, _, err := image.Decode(bytes.NewReader(body))
+		if err != nil {
+			return o, fmt.Errorf("%w: image: %v", errInvalidSetting, err)
+		}
+		o.img = fitImage(src)
+	case "", "text/plain", "text/markdown":
+		if strings.TrimSpace(string(body)) == "" {
+			return o, fmt.Errorf("%w: empty message", errInvalidSetting)
+		}
+		o.markdown = string(body)
+	default:
+		return o, fmt.Errorf("%w: content type %q", errInvalidSetting, ctype)
+	}
+	return o, nil
+}
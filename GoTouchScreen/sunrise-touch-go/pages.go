@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+)
+
+// Page is one dashboard page. Pages draw below the header: the left column
+// and the right column under the title, unless they take the whole frame as
+// a fullFramePage. They get the body touches the header doesn't take, and
+// say when they next want drawing and how.
+type Page interface {
+	// Title is the page's name in config, the control API and MQTT.
+	Title() string
+	Render(img *image.Gray, pc pageContext)
+	// HandleTouch reports whether the touch hit anything on the page.
+	HandleTouch(st *appState, x, y int) bool
+	// NextRefresh is when the page wants redrawing, given the last draw and
+	// the configured interval.
+	NextRefresh(last time.Time, every time.Duration) time.Time
+	// Partial reports whether the page's redraws may use partial refresh.
+	Partial() bool
+}
+
+// pageContext is what the main loop knows at draw time.
+type pageContext struct {
+	now            time.Time
+	sun            sunOutlook
+	lat, lon       float64
+	refreshEvery   time.Duration
+	tick           int
+	touchCount     int
+	startedAt      time.Time
+	partialEnabled bool
+	lifetime       panelStats
+	sysHist        []sysSample
+	th             uiTheme
+}
+
+// pageDeps are the background services pages draw from; nil when disabled.
+type pageDeps struct {
+	weather    *weatherService
+	calendar   *calendarService
+	flights    *flightService
+	flightsMax int
+	partial    bool
+	ha         *haService
+	haEntities []string
+}
+
+// pageRegistry lists every page in its default order. A page whose service
+// is off is left out unless the config asks for it by name.
+var pageRegistry = []struct {
+	name    string
+	make    func(d pageDeps) Page
+	enabled func(d pageDeps) bool
+}{
+	{"sunrise", func(pageDeps) Page { return sunrisePage{} }, nil},
+	{"stats", func(pageDeps) Page { return statsPage{} }, nil},
+	{"art", func(pageDeps) Page { return artPage{} }, nil},
+	{"moon", func(pageDeps) Page { return moonPage{} }, nil},
+	{"weather", func(d pageDeps) Page { return weatherPage{ws: d.weather} }, func(d pageDeps) bool { return d.weather != nil }},
+	{"agenda", func(d pageDeps) Page { return &agendaPage{cal: d.calendar} }, func(d pageDeps) bool { return d.calendar != nil }},
+	{"flights", func(d pageDeps) Page { return &flightsPage{fs: d.flights, max: d.flightsMax, partial: d.partial} }, func(d pageDeps) bool { return d.flights != nil }},
+	{"home", func(d pageDeps) Page { return &homePage{ha: d.ha, entities: d.haEntities} }, func(d pageDeps) bool { return d.ha != nil }},
+}
+
+func pageRegistryNames() []string {
+	var names []string
+	for _, r := range pageRegistry {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// buildPages makes the pages named in config, in that order, or the default
+// set when none are named. Unknown and repeated names are reported and
+// skipped; an empty result falls back to the sunrise page.
+func buildPages(names []string, d pageDeps) ([]Page, []error) {
+	var pages []Page
+	var errs []error
+	seen := map[string]bool{}
+	if len(names) == 0 {
+		for _, r := range pageRegistry {
+			if r.enabled == nil || r.enabled(d) {
+				pages = append(pages, r.make(d))
+			}
+		}
+		return pages, nil
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, r := range pageRegistry {
+			if r.name == name {
+				found = true
+				if seen[name] {
+					errs = append(errs, fmt.Errorf("page %q listed twice", name))
+					break
+				}
+				seen[name] = true
+				pages = append(pages, r.make(d))
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("unknown page %q (have %s)", name, strings.Join(pageRegistryNames(), ", ")))
+		}
+	}
+	if len(pages) == 0 {
+		pages = []Page{sunrisePage{}}
+	}
+	return pages, errs
+}
+
+func pageTitles(pages []Page) []string {
+	out := make([]string, len(pages))
+	for i, p := range pages {
+		out[i] = p.Title()
+	}
+	return out
+}
+
+func (st appState) currentPage() Page {
+	if len(st.pages) == 0 {
+		return sunrisePage{}
+	}
+	return st.pages[st.page%len(st.pages)]
+}
+
+// onPage reports whether the current page, rather than a menu or overlay
+// over it, is what the panel shows.
+func (st appState) onPage() bool {
+	return !st.showCalibration && st.activeOverlay() < 0 && !st.showKeypad &&
+		!st.showCityPicker && !st.showSettings && !fullFrame(st.currentPage())
+}
+
+// fullFramePage is a page that can take over the whole frame, header
+// included, as the agenda does for an event's details. While FullFrame
+// holds, it gets every touch and the carousel waits.
+type fullFramePage interface {
+	Page
+	FullFrame() bool
+}
+
+func fullFrame(p Page) bool {
+	f, ok := p.(fullFramePage)
+	return ok && f.FullFrame()
+}
+
+// pageDefaults gives a page the configured interval, partial refresh and no
+// touch targets of its own.
+type pageDefaults struct{}
+
+func (pageDefaults) HandleTouch(*appState, int, int) bool { return false }
+
+func (pageDefaults) NextRefresh(last time.Time, every time.Duration) time.Time {
+	return last.Add(every)
+}
+
+func (pageDefaults) Partial() bool { return true }
+
+type sunrisePage struct{ pageDefaults }
+
+func (sunrisePage) Title() string { return "sunrise" }
+
+func (sunrisePage) Render(img *image.Gray, pc pageContext) {
+	renderSunrisePage(img, pc.now, pc.sun, pc.lat, pc.lon, pc.refreshEvery, pc.th)
+}
+
+type statsPage struct{ pageDefaults }
+
+func (statsPage) Title() string { return "stats" }
+
+func (statsPage) Render(img *image.Gray, pc pageContext) {
+	renderStatsPage(img, pc.sysHist, pc.touchCount, pc.tick, pc.startedAt, pc.partialEnabled, pc.lifetime, pc.th)
+}
+
+type artPage struct{ pageDefaults }
+
+func (artPage) Title() string { return "art" }
+
+func (artPage) Render(img *image.Gray, pc pageContext) {
+	renderArtPage(img, pc.now, pc.tick, pc.th)
+}
+
+// Partial is off: every frame moves the whole pattern, which partial
+// refresh would leave ghosted.
+func (artPage) Partial() bool { return false }
+
+type moonPage struct{ pageDefaults }
+
+func (moonPage) Title() string { return "moon" }
+
+func (moonPage) Render(img *image.Gray, pc pageContext) {
+	renderMoonPage(img, pc.now, pc.lat, pc.lon, pc.th)
+}
+
+// NextRefresh stretches short intervals: nothing on the page moves faster
+// than the illumination percentage.
+func (moonPage) NextRefresh(last time.Time, every time.Duration) time.Time {
+	return last.Add(max(every, 30*time.Minute))
+}
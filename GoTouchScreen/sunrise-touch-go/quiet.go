@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font/inconsolata"
+)
+
+// Quiet hours: overnight the panel shows one static night frame and sleeps
+// instead of flashing a refresh every interval. A touch wakes it for a while.
+
+const defaultQuietWake = time.Minute
+
+// quietEdge is one end of the quiet window: a clock time, or sunrise/sunset
+// shifted by an offset ("sunset+30m", "sunrise-15m").
+type quietEdge struct {
+	sun          string // "sunrise", "sunset", or "" for a clock time
+	offset       time.Duration
+	hour, minute int
+}
+
+func parseQuietEdge(s string) (quietEdge, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, ev := range []string{"sunrise", "sunset"} {
+		if rest, ok := strings.CutPrefix(s, ev); ok {
+			e := quietEdge{sun: ev}
+			if rest != "" {
+				d, err := time.ParseDuration(rest)
+				if err != nil {
+					return quietEdge{}, fmt.Errorf("quiet hours: bad offset in %q", s)
+				}
+				e.offset = d
+			}
+			return e, nil
+		}
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return quietEdge{}, fmt.Errorf("quiet hours: %q is not HH:MM, sunrise or sunset", s)
+	}
+	return quietEdge{hour: t.Hour(), minute: t.Minute()}, nil
+}
+
+// at places the edge on the given date. A sun edge on a date without that
+// event (polar day or night) doesn't happen.
+func (e quietEdge) at(day time.Time, lat, lon float64, loc *time.Location) (time.Time, bool) {
+	day = day.In(loc)
+	if e.sun == "" {
+		return time.Date(day.Year(), day.Month(), day.Day(), e.hour, e.minute, 0, 0, loc), true
+	}
+	sd := solarDayFor(day, lat, lon, loc)
+	t := sd.sunset
+	if e.sun == "sunrise" {
+		t = sd.sunrise
+	}
+	if t.IsZero() {
+		return time.Time{}, false
+	}
+	return t.Add(e.offset), true
+}
+
+type quietHours struct {
+	start, end quietEdge
+	wake       time.Duration
+}
+
+func parseQuietHours(start, end string, wake time.Duration) (*quietHours, error) {
+	if start == "" || end == "" {
+		return nil, fmt.Errorf("quiet hours: need both a start and an end")
+	}
+	q := &quietHours{wake: wake}
+	var err error
+	if q.start, err = parseQuietEdge(start); err != nil {
+		return nil, err
+	}
+	if q.end, err = parseQuietEdge(end); err != nil {
+		return nil, err
+	}
+	if q.wake <= 0 {
+		q.wake = defaultQuietWake
+	}
+	return q, nil
+}
+
+// active reports whether now is inside a quiet window and when that window
+// ends. Windows start on the day before or on today; one whose end comes at
+// or before its start runs past midnight to the next day's end.
+func (q *quietHours) active(now time.Time, lat, lon float64, loc *time.Location) (bool, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+		s, ok := q.start.at(day, lat, lon, loc)
+		if !ok {
+			continue
+		}
+		e, ok := q.end.at(day, lat, lon, loc)
+		if !ok || !e.After(s) {
+			if e, ok = q.end.at(day.AddDate(0, 0, 1), lat, lon, loc); !ok {
+				continue
+			}
+		}
+		if !now.Before(s) && now.Before(e) {
+			return true, e
+		}
+	}
+	return false, time.Time{}
+}
+
+// renderNightFrame is the static quiet-hours frame. It shows nothing that
+// goes stale overnight: no clock, just when the panel wakes up again.
+func renderNightFrame(until time.Time, th uiTheme) *image.Gray {
+	const w = 250
+	const h = 122
+	bg, fg := th.Background, th.Foreground
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: bg}}, image.Point{}, draw.Src)
+
+	// Crescent: a disc with an offset disc taken out of it.
+	circle(img, 58, 61, 22, fg, true)
+	circle(img, 68, 55, 20, bg, true)
+
+	textFace(img, 104, 56, "Quiet hours", fg, inconsolata.Bold8x16)
+	text(img, 104, 76, "until "+until.Format("15:04"), fg, th)
+	text(img, 104, 96, "Tap to wake", fg, th)
+	return img
+}
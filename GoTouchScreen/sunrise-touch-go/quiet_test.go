@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursActive(t *testing.T) {
+	// Sun edges are checked to the minute the NOAA tables give.
+	const tolerance = 2 * time.Minute
+	const (
+		london  = "Europe/London"
+		tromsoe = "Europe/Oslo"
+	)
+	tests := []struct {
+		name       string
+		tz         string
+		lat, lon   float64
+		start, end string
+		now        string // local "2006-01-02 15:04"
+		until      string // when the window ends; "" when not quiet
+	}{
+		// A clock window past midnight belongs to the evening it starts on.
+		{"wrap, evening", london, 51.5074, -0.1278, "22:00", "07:00", "2024-06-21 23:30", "2024-06-22 07:00"},
+		{"wrap, small hours", london, 51.5074, -0.1278, "22:00", "07:00", "2024-06-22 03:00", "2024-06-22 07:00"},
+		{"wrap, at start", london, 51.5074, -0.1278, "22:00", "07:00", "2024-06-21 22:00", "2024-06-22 07:00"},
+		{"wrap, at end", london, 51.5074, -0.1278, "22:00", "07:00", "2024-06-22 07:00", ""},
+		{"wrap, midday", london, 51.5074, -0.1278, "22:00", "07:00", "2024-06-22 12:00", ""},
+		// The clocks go forward at 01:00 that night; 07:00 is still 07:00 BST.
+		{"wrap over DST", london, 51.5074, -0.1278, "22:00", "07:00", "2024-03-31 06:30", "2024-03-31 07:00"},
+		{"same day", london, 51.5074, -0.1278, "13:00", "15:00", "2024-06-21 14:00", "2024-06-21 15:00"},
+		{"same day, after", london, 51.5074, -0.1278, "13:00", "15:00", "2024-06-21 15:30", ""},
+		{"same day, small hours", london, 51.5074, -0.1278, "13:00", "15:00", "2024-06-22 01:00", ""},
+
+		// Sunset 21:21 and sunrise 04:43 BST around midsummer.
+		{"before sunset+30m", london, 51.5074, -0.1278, "sunset+30m", "sunrise-15m", "2024-06-21 21:45", ""},
+		{"after sunset+30m", london, 51.5074, -0.1278, "sunset+30m", "sunrise-15m", "2024-06-21 22:00", "2024-06-22 04:28"},
+		{"before sunrise-15m", london, 51.5074, -0.1278, "sunset+30m", "sunrise-15m", "2024-06-22 04:20", "2024-06-22 04:28"},
+		{"after sunrise-15m", london, 51.5074, -0.1278, "sunset+30m", "sunrise-15m", "2024-06-22 04:35", ""},
+		// Mixed edges; midwinter sunset 15:53, sunrise 08:04.
+		{"sunset to clock", london, 51.5074, -0.1278, "sunset", "06:00", "2024-12-21 16:00", "2024-12-22 06:00"},
+		{"clock to sunrise", london, 51.5074, -0.1278, "22:00", "sunrise", "2024-12-21 23:00", "2024-12-22 08:04"},
+
+		// Under the midnight sun there is no sunset to start from, nor a
+		// sunrise to end on: never quiet.
+		{"midnight sun, night", tromsoe, 69.6492, 18.9553, "sunset", "sunrise", "2024-06-21 01:00", ""},
+		{"midnight sun, evening", tromsoe, 69.6492, 18.9553, "sunset", "sunrise", "2024-06-21 23:00", ""},
+		{"midnight sun, no sunrise", tromsoe, 69.6492, 18.9553, "22:00", "sunrise", "2024-06-21 23:00", ""},
+		{"polar night, no sunset", tromsoe, 69.6492, 18.9553, "sunset", "08:00", "2024-12-21 23:00", ""},
+		// Clock windows don't care.
+		{"polar night, clock", tromsoe, 69.6492, 18.9553, "22:00", "07:00", "2024-12-21 23:00", "2024-12-22 07:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.tz)
+			if err != nil {
+				t.Skip(err)
+			}
+			q, err := parseQuietHours(tt.start, tt.end, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now, _ := time.ParseInLocation("2006-01-02 15:04", tt.now, loc)
+			on, until := q.active(now, tt.lat, tt.lon, loc)
+			if tt.until == "" {
+				if on {
+					t.Errorf("quiet until %v, want not quiet", until.Format("2006-01-02 15:04"))
+				}
+				return
+			}
+			want, _ := time.ParseInLocation("2006-01-02 15:04", tt.until, loc)
+			if d := until.Sub(want); !on || d < -tolerance || d > tolerance {
+				t.Errorf("quiet %v until %v, want until %s", on, until.Format("2006-01-02 15:04"), tt.until)
+			}
+		})
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	for _, tt := range []struct {
+		start, end string
+		ok         bool
+	}{
+		{"22:00", "07:00", true},
+		{"Sunset+1h", " sunrise-15m ", true},
+		{"22:00", "", false},
+		{"10pm", "07:00", false},
+		{"sunset+soon", "07:00", false},
+	} {
+		q, err := parseQuietHours(tt.start, tt.end, 0)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseQuietHours(%q, %q) error %v", tt.start, tt.end, err)
+		}
+		if err == nil && q.wake != defaultQuietWake {
+			t.Errorf("wake %v, want the default", q.wake)
+		}
+	}
+}
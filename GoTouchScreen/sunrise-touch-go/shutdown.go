@@ -0,0 +1,34 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+
+	"golang.org/x/image/font/inconsolata"
+)
+
+// renderOfflineFrame is the parting frame left on the panel when the service
+// stops: e-paper keeps it unpowered, so it must not look like live data.
+func renderOfflineFrame(message string, lastUpdated time.Time, th uiTheme) *image.Gray {
+	const w = 250
+	const h = 122
+	bg, fg := th.Background, th.Foreground
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: bg}}, image.Point{}, draw.Src)
+	rectOutline(img, 2, 2, w-3, h-3, fg)
+
+	if len(message) > 28 {
+		message = message[:27] + "."
+	}
+	textFace(img, (w-len(message)*8)/2, 48, message, fg, inconsolata.Bold8x16)
+	line(img, 40, 60, w-41, 60, fg)
+	text(img, 80, 80, "Last updated", fg, th)
+	when := "never"
+	if !lastUpdated.IsZero() {
+		when = lastUpdated.Format("Mon Jan 2 15:04 MST")
+	}
+	text(img, (w-len(when)*7)/2, 98, when, fg, th)
+	return img
+}
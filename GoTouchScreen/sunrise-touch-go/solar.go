@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Zenith angles for the horizon crossing and the three twilight limits. The
+// sunrise value includes standard refraction and the solar semi-diameter.
+const (
+	zenithSunrise      = 90.833
+	zenithCivil        = 96.0
+	zenithNautical     = 102.0
+	zenithAstronomical = 108.0
+)
+
+// solarDay holds the sun events for one calendar date at a location. An event
+// that does not happen on that date (polar day or night, or twilight that never
+// ends in high-latitude summer) is left as the zero time.
+type solarDay struct {
+	date         time.Time
+	solarNoon    time.Time
+	sunrise      time.Time
+	sunset       time.Time
+	civilDawn    time.Time
+	civilDusk    time.Time
+	nauticalDawn time.Time
+	nauticalDusk time.Time
+	astroDawn    time.Time
+	astroDusk    time.Time
+	dayLength    time.Duration
+	// Set when there is no sunrise/sunset because the sun stays above or
+	// below the horizon all day.
+	alwaysUp   bool
+	alwaysDown bool
+}
+
+// solarParams are the NOAA intermediate values that everything else is
+// derived from, evaluated for a given instant.
+type solarParams struct {
+	declination float64 // degrees
+	eqTime      float64 // minutes
+}
+
+func julianDay(t time.Time) float64 {
+	return float64(t.UTC().UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+func solarParamsAt(t time.Time) solarParams {
+	jc := (julianDay(t) - 2451545.0) / 36525.0
+
+	l0 := normalizeDeg(280.46646 + jc*(36000.76983+jc*0.0003032))
+	m := 357.52911 + jc*(35999.05029-0.0001537*jc)
+	e := 0.016708634 - jc*(0.000042037+0.0000001267*jc)
+	c := math.Sin(deg2rad(m))*(1.914602-jc*(0.004817+0.000014*jc)) +
+		math.Sin(deg2rad(2*m))*(0.019993-0.000101*jc) +
+		math.Sin(deg2rad(3*m))*0.000289
+	trueLong := l0 + c
+	omega := 125.04 - 1934.136*jc
+	appLong := trueLong - 0.00569 - 0.00478*math.Sin(deg2rad(omega))
+	meanObliq := 23 + (26+(21.448-jc*(46.815+jc*(0.00059-jc*0.001813)))/60)/60
+	obliq := meanObliq + 0.00256*math.Cos(deg2rad(omega))
+	decl := rad2deg(math.Asin(math.Sin(deg2rad(obliq)) * math.Sin(deg2rad(appLong))))
+
+	y := math.Pow(math.Tan(deg2rad(obliq/2)), 2)
+	l0r, mr := deg2rad(l0), deg2rad(m)
+	eqTime := 4 * rad2deg(y*math.Sin(2*l0r)-
+		2*e*math.Sin(mr)+
+		4*e*y*math.Sin(mr)*math.Cos(2*l0r)-
+		0.5*y*y*math.Sin(4*l0r)-
+		1.25*e*e*math.Sin(2*mr))
+	return solarParams{declination: decl, eqTime: eqTime}
+}
+
+// hourAngle returns the hour angle in degrees at which the sun reaches the
+// given zenith. ok is false when it never does; in that case above reports
+// whether the sun stays above (true) or below (false) that zenith.
+func hourAngle(lat, decl, zenith float64) (ha float64, ok, above bool) {
+	latR, declR := deg2rad(lat), deg2rad(decl)
+	cosHA := math.Cos(deg2rad(zenith))/(math.Cos(latR)*math.Cos(declR)) - math.Tan(latR)*math.Tan(declR)
+	if cosHA > 1 {
+		return 0, false, false
+	}
+	if cosHA < -1 {
+		return 0, false, true
+	}
+	return rad2deg(math.Acos(cosHA)), true, false
+}
+
+// solarDayFor computes the sun events for the calendar date of day in loc.
+// Each event is refined once using solar parameters at its own instant, which
+// keeps results within a minute or so of the NOAA calculator.
+func solarDayFor(day time.Time, lat, lon float64, loc *time.Location) solarDay {
+	day = day.In(loc)
+	midnightUTC := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	atMinutes := func(min float64) time.Time {
+		return midnightUTC.Add(time.Duration(min * float64(time.Minute)))
+	}
+
+	// Solar noon in UTC minutes from that midnight, refined at the noon
+	// instant. Far from Greenwich this lands on the wrong local date (at
+	// Kiritimati, UTC+14 at 157W, it is the next day's noon), so shift by
+	// whole days to the transit nearest local noon.
+	localNoon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, loc)
+	shift := 1440 * math.Round(localNoon.Sub(atMinutes(720-4*lon)).Hours()/24)
+	noonMin := shift + 720 - 4*lon
+	p := solarParamsAt(atMinutes(noonMin))
+	noonMin = shift + 720 - 4*lon - p.eqTime
+	p = solarParamsAt(atMinutes(noonMin))
+	noonMin = shift + 720 - 4*lon - p.eqTime
+
+	sd := solarDay{
+		date:      time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc),
+		solarNoon: atMinutes(noonMin).In(loc),
+	}
+
+	event := func(zenith float64, rising bool) (time.Time, bool, bool) {
+		guess := noonMin
+		var t time.Time
+		for i := 0; i < 2; i++ {
+			p := solarParamsAt(atMinutes(guess))
+			ha, ok, above := hourAngle(lat, p.declination, zenith)
+			if !ok {
+				return time.Time{}, false, above
+			}
+			if rising {
+				ha = -ha
+			}
+			guess = shift + 720 - 4*(lon-ha) - p.eqTime
+			t = atMinutes(guess)
+		}
+		return t.In(loc), true, false
+	}
+
+	var ok, above bool
+	if sd.sunrise, ok, above = event(zenithSunrise, true); !ok {
+		sd.alwaysUp = above
+		sd.alwaysDown = !above
+	}
+	sd.sunset, _, _ = event(zenithSunrise, false)
+	sd.civilDawn, _, _ = event(zenithCivil, true)
+	sd.civilDusk, _, _ = event(zenithCivil, false)
+	sd.nauticalDawn, _, _ = event(zenithNautical, true)
+	sd.nauticalDusk, _, _ = event(zenithNautical, false)
+	sd.astroDawn, _, _ = event(zenithAstronomical, true)
+	sd.astroDusk, _, _ = event(zenithAstronomical, false)
+
+	switch {
+	case sd.alwaysUp:
+		sd.dayLength = 24 * time.Hour
+	case !sd.sunrise.IsZero() && !sd.sunset.IsZero():
+		sd.dayLength = sd.sunset.Sub(sd.sunrise)
+	}
+	return sd
+}
+
+// sunPosition returns the sun's apparent elevation (corrected for atmospheric
+// refraction) and azimuth, clockwise from north, in degrees at instant t.
+func sunPosition(t time.Time, lat, lon float64) (elevation, azimuth float64) {
+	p := solarParamsAt(t)
+	u := t.UTC()
+	minutes := float64(u.Hour()*60+u.Minute()) + float64(u.Second())/60 + float64(u.Nanosecond())/6e10
+	trueSolar := math.Mod(minutes+p.eqTime+4*lon, 1440)
+	if trueSolar < 0 {
+		trueSolar += 1440
+	}
+	ha := trueSolar/4 - 180
+	if ha < -180 {
+		ha += 360
+	}
+
+	latR, declR := deg2rad(lat), deg2rad(p.declination)
+	cosZen := math.Sin(latR)*math.Sin(declR) + math.Cos(latR)*math.Cos(declR)*math.Cos(deg2rad(ha))
+	cosZen = math.Max(-1, math.Min(1, cosZen))
+	zen := rad2deg(math.Acos(cosZen))
+	elevation = 90 - zen + refraction(90-zen)
+
+	denom := math.Cos(latR) * math.Sin(deg2rad(zen))
+	if math.Abs(denom) < 1e-9 {
+		// Sun at the zenith or observer at a pole; azimuth is undefined.
+		return elevation, 180
+	}
+	cosAz := (math.Sin(latR)*math.Cos(deg2rad(zen)) - math.Sin(declR)) / denom
+	cosAz = math.Max(-1, math.Min(1, cosAz))
+	az := rad2deg(math.Acos(cosAz))
+	if ha > 0 {
+		azimuth = normalizeDeg(az + 180)
+	} else {
+		azimuth = normalizeDeg(540 - az)
+	}
+	return elevation, azimuth
+}
+
+// refraction is the NOAA approximation of atmospheric refraction, in degrees,
+// for a true elevation in degrees.
+func refraction(elev float64) float64 {
+	if elev > 85 {
+		return 0
+	}
+	te := math.Tan(deg2rad(elev))
+	var arcsec float64
+	switch {
+	case elev > 5:
+		arcsec = 58.1/te - 0.07/math.Pow(te, 3) + 0.000086/math.Pow(te, 5)
+	case elev > -0.575:
+		arcsec = 1735 + elev*(-518.2+elev*(103.4+elev*(-12.79+elev*0.711)))
+	default:
+		arcsec = -20.772 / te
+	}
+	return arcsec / 3600
+}
+
+// maxSunSearchDays bounds the forward search for the next sunrise or sunset.
+// Even at the poles the sun crosses the horizon within a year.
+const maxSunSearchDays = 370
+
+// sunOutlook is what the sunrise page needs to know about the sun from now
+// on, including whether the location is currently in polar night or under
+// the midnight sun.
+type sunOutlook struct {
+	sunrise     time.Time // next real sunrise
+	polarNight  bool
+	midnightSun bool
+	// When the polar condition ends: the returning sunrise for polar night,
+	// the first sunset for midnight sun.
+	polarEnds time.Time
+}
+
+func sunOutlookFor(now time.Time, lat, lon float64, loc *time.Location) (sunOutlook, error) {
+	today := solarDayFor(now, lat, lon, loc)
+	out := sunOutlook{polarNight: today.alwaysDown, midnightSun: today.alwaysUp}
+	if out.midnightSun {
+		if ss, err := nextSunset(now, lat, lon, loc); err == nil {
+			out.polarEnds = ss
+		}
+	}
+	sr, err := nextSunrise(now, lat, lon, loc)
+	if err != nil {
+		return out, err
+	}
+	out.sunrise = sr
+	if out.polarNight {
+		out.polarEnds = sr
+	}
+	return out, nil
+}
+
+func nextSunset(now time.Time, lat, lon float64, loc *time.Location) (time.Time, error) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i <= maxSunSearchDays; i++ {
+		ss := solarDayFor(day.AddDate(0, 0, i), lat, lon, loc).sunset
+		if !ss.IsZero() && now.Before(ss) {
+			return ss, nil
+		}
+	}
+	return time.Time{}, errors.New("no sunset within a year for this lat")
+}
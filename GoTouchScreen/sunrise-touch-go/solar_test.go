@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Published sunrise/sunset times (timeanddate.com, rounded to the minute).
+// The NOAA method is good to a minute or so away from the poles.
+func TestSolarDayFor(t *testing.T) {
+	const tolerance = 3 * time.Minute
+	tests := []struct {
+		name                 string
+		tz                   string
+		lat, lon             float64
+		date                 string
+		sunrise, sunset      string // local "2006-01-02 15:04"; "" when there is none
+		alwaysUp, alwaysDown bool
+	}{
+		{"London midsummer", "Europe/London", 51.5074, -0.1278, "2024-06-21", "2024-06-21 04:43", "2024-06-21 21:21", false, false},
+		{"London midwinter", "Europe/London", 51.5074, -0.1278, "2024-12-21", "2024-12-21 08:04", "2024-12-21 15:53", false, false},
+		{"New York equinox", "America/New_York", 40.7128, -74.0060, "2024-03-20", "2024-03-20 06:58", "2024-03-20 19:09", false, false},
+		{"Sydney summer", "Australia/Sydney", -33.8688, 151.2093, "2024-12-21", "2024-12-21 05:41", "2024-12-21 20:05", false, false},
+		// Zones on the far side of the date line from their longitude
+		// (UTC+14 and +13 at 157W and 175W): events must stay on the local
+		// date, which is what these rows are mostly about.
+		{"Kiritimati", "Pacific/Kiritimati", 1.8721, -157.4278, "2024-06-21", "2024-06-21 06:25", "2024-06-21 18:38", false, false},
+		{"Tongatapu", "Pacific/Tongatapu", -21.1393, -175.2049, "2024-06-21", "2024-06-21 07:17", "2024-06-21 18:08", false, false},
+		// UTC-11 east of it.
+		{"Pago Pago", "Pacific/Pago_Pago", -14.2756, -170.7020, "2024-06-21", "2024-06-21 06:46", "2024-06-21 18:03", false, false},
+		{"Tromsø polar night", "Europe/Oslo", 69.6492, 18.9553, "2024-12-21", "", "", false, true},
+		{"Tromsø midnight sun", "Europe/Oslo", 69.6492, 18.9553, "2024-06-21", "", "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.tz)
+			if err != nil {
+				t.Skip(err)
+			}
+			day, _ := time.ParseInLocation("2006-01-02", tt.date, loc)
+			sd := solarDayFor(day, tt.lat, tt.lon, loc)
+			check := func(what string, got time.Time, want string) {
+				t.Helper()
+				if want == "" {
+					if !got.IsZero() {
+						t.Errorf("%s = %v, want none", what, got)
+					}
+					return
+				}
+				w, _ := time.ParseInLocation("2006-01-02 15:04", want, loc)
+				if d := got.Sub(w); d < -tolerance || d > tolerance {
+					t.Errorf("%s = %v, want %s", what, got.Format("2006-01-02 15:04"), want)
+				}
+			}
+			check("sunrise", sd.sunrise, tt.sunrise)
+			check("sunset", sd.sunset, tt.sunset)
+			if sd.alwaysUp != tt.alwaysUp || sd.alwaysDown != tt.alwaysDown {
+				t.Errorf("alwaysUp/alwaysDown = %v/%v, want %v/%v", sd.alwaysUp, sd.alwaysDown, tt.alwaysUp, tt.alwaysDown)
+			}
+		})
+	}
+}
+
+func TestNextSunrise(t *testing.T) {
+	tests := []struct {
+		name     string
+		tz       string
+		lat, lon float64
+		now      string
+		want     string // local date of the sunrise
+	}{
+		{"Kiritimati before dawn", "Pacific/Kiritimati", 1.8721, -157.4278, "2024-06-21 03:00", "2024-06-21"},
+		{"Kiritimati after dawn", "Pacific/Kiritimati", 1.8721, -157.4278, "2024-06-21 09:00", "2024-06-22"},
+		{"Pago Pago before dawn", "Pacific/Pago_Pago", -14.2756, -170.7020, "2024-06-21 03:00", "2024-06-21"},
+		// The sun first clears the horizon on 15 January (NOAA: 11:24-12:23).
+		{"Tromsø polar night", "Europe/Oslo", 69.6492, 18.9553, "2024-12-21 12:00", "2025-01-15"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.tz)
+			if err != nil {
+				t.Skip(err)
+			}
+			now, _ := time.ParseInLocation("2006-01-02 15:04", tt.now, loc)
+			sr, err := nextSunrise(now, tt.lat, tt.lon, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sr.Format("2006-01-02"); got != tt.want {
+				t.Errorf("next sunrise %v, want on %s", sr, tt.want)
+			}
+		})
+	}
+}
+
+// Solar noon, twilight and day length from the NOAA Solar Calculator
+// spreadsheet equations, local time rounded to the minute. "" marks a
+// twilight the sun never reaches that day.
+func TestSolarDayEvents(t *testing.T) {
+	const tolerance = 2 * time.Minute
+	tests := []struct {
+		name            string
+		tz              string
+		lat, lon        float64
+		date            string
+		noon            string
+		civil, nautical [2]string // dawn, dusk
+		astro           [2]string
+		dayLength       time.Duration
+	}{
+		// No astronomical night in a London June.
+		{"London midsummer", "Europe/London", 51.5074, -0.1278, "2024-06-21", "13:02",
+			[2]string{"03:55", "22:09"}, [2]string{"02:41", "23:24"}, [2]string{"", ""}, 16*time.Hour + 38*time.Minute},
+		{"London midwinter", "Europe/London", 51.5074, -0.1278, "2024-12-21", "11:59",
+			[2]string{"07:24", "16:34"}, [2]string{"06:41", "17:17"}, [2]string{"06:00", "17:58"}, 7*time.Hour + 49*time.Minute},
+		{"New York equinox", "America/New_York", 40.7128, -74.0060, "2024-03-20", "13:03",
+			[2]string{"06:31", "19:36"}, [2]string{"05:59", "20:08"}, [2]string{"05:26", "20:40"}, 12*time.Hour + 10*time.Minute},
+		{"Sydney summer", "Australia/Sydney", -33.8688, 151.2093, "2024-12-21", "12:53",
+			[2]string{"05:12", "20:35"}, [2]string{"04:36", "21:11"}, [2]string{"03:57", "21:50"}, 14*time.Hour + 25*time.Minute},
+		// No sunrise, but every twilight still comes and goes.
+		{"Tromsø polar night", "Europe/Oslo", 69.6492, 18.9553, "2024-12-21", "11:42",
+			[2]string{"09:32", "13:53"}, [2]string{"07:47", "15:38"}, [2]string{"06:29", "16:56"}, 0},
+		{"Tromsø midnight sun", "Europe/Oslo", 69.6492, 18.9553, "2024-06-21", "12:46",
+			[2]string{"", ""}, [2]string{"", ""}, [2]string{"", ""}, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.tz)
+			if err != nil {
+				t.Skip(err)
+			}
+			day, _ := time.ParseInLocation("2006-01-02", tt.date, loc)
+			sd := solarDayFor(day, tt.lat, tt.lon, loc)
+			check := func(what string, got time.Time, want string) {
+				t.Helper()
+				if want == "" {
+					if !got.IsZero() {
+						t.Errorf("%s = %v, want none", what, got)
+					}
+					return
+				}
+				w, _ := time.ParseInLocation("2006-01-02 15:04", tt.date+" "+want, loc)
+				if d := got.Sub(w); d < -tolerance || d > tolerance {
+					t.Errorf("%s = %v, want %s", what, got.Format("2006-01-02 15:04"), want)
+				}
+			}
+			check("solar noon", sd.solarNoon, tt.noon)
+			check("civil dawn", sd.civilDawn, tt.civil[0])
+			check("civil dusk", sd.civilDusk, tt.civil[1])
+			check("nautical dawn", sd.nauticalDawn, tt.nautical[0])
+			check("nautical dusk", sd.nauticalDusk, tt.nautical[1])
+			check("astronomical dawn", sd.astroDawn, tt.astro[0])
+			check("astronomical dusk", sd.astroDusk, tt.astro[1])
+			if d := sd.dayLength - tt.dayLength; d < -tolerance || d > tolerance {
+				t.Errorf("day length = %v, want %v", sd.dayLength, tt.dayLength)
+			}
+		})
+	}
+}
+
+// Apparent elevation and azimuth from the NOAA spreadsheet equations,
+// including its refraction correction.
+func TestSunPosition(t *testing.T) {
+	tests := []struct {
+		name           string
+		lat, lon       float64
+		utc            string
+		elevation, azi float64
+	}{
+		{"London midsummer noon", 51.5074, -0.1278, "2024-06-21 12:00", 61.93, 178.81},
+		{"London winter morning", 51.5074, -0.1278, "2024-12-21 08:30", 2.49, 133.50},
+		{"New York equinox noon", 40.7128, -74.0060, "2024-03-20 17:00", 49.52, 178.75},
+		{"New York equinox evening", 40.7128, -74.0060, "2024-03-20 22:30", 6.62, 264.81},
+		// Southern summer: the sun is north of the zenith.
+		{"Sydney summer noon", -33.8688, 151.2093, "2024-12-21 02:00", 79.47, 351.54},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse("2006-01-02 15:04", tt.utc)
+		el, az := sunPosition(at, tt.lat, tt.lon)
+		if math.Abs(el-tt.elevation) > 0.1 || math.Abs(az-tt.azi) > 0.1 {
+			t.Errorf("%s: elevation %.2f azimuth %.2f, want %.2f %.2f", tt.name, el, az, tt.elevation, tt.azi)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// panelStats are lifetime counters for the attached panel. E-paper has a
+// finite refresh life, so these survive restarts and can be exported per unit.
+type panelStats struct {
+	FullRefreshes    int64     `json:"full_refreshes"`
+	PartialRefreshes int64     `json:"partial_refreshes"`
+	Touches          int64     `json:"touches"`
+	WakeCycles       int64     `json:"wake_cycles"`
+	Errors           int64     `json:"errors"`
+	FirstStarted     time.Time `json:"first_started"`
+	LastSaved        time.Time `json:"last_saved"`
+}
+
+func defaultStatsPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "stats.json")
+}
+
+func loadPanelStats(path string) (panelStats, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return panelStats{}, err
+	}
+	var s panelStats
+	if err := json.Unmarshal(b, &s); err != nil {
+		return panelStats{}, err
+	}
+	return s, nil
+}
+
+func savePanelStats(path string, s panelStats) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written after every draw, so go through a temp file to avoid leaving a
+	// truncated file behind on power loss.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func exportPanelStats(w io.Writer, format string, s panelStats) error {
+	switch format {
+	case "", "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case "csv":
+		host, _ := os.Hostname()
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"host", "full_refreshes", "partial_refreshes", "touches", "wake_cycles", "errors", "first_started", "last_saved"})
+		_ = cw.Write([]string{
+			host,
+			strconv.FormatInt(s.FullRefreshes, 10),
+			strconv.FormatInt(s.PartialRefreshes, 10),
+			strconv.FormatInt(s.Touches, 10),
+			strconv.FormatInt(s.WakeCycles, 10),
+			strconv.FormatInt(s.Errors, 10),
+			s.FirstStarted.Format(time.RFC3339),
+			s.LastSaved.Format(time.RFC3339),
+		})
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown stats format %q (want json or csv)", format)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sysSample is one reading of host metrics. Fields that could not be read are
+// left at zero and flagged through the has* booleans.
+type sysSample struct {
+	at          time.Time
+	cpuPct      float64
+	memUsedPct  float64
+	memTotalKB  uint64
+	load1       float64
+	load5       float64
+	load15      float64
+	tempC       float64
+	hasTemp     bool
+	diskUsedPct float64
+	hasDisk     bool
+	rxBps       float64
+	txBps       float64
+	addrs       []string
+}
+
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// sysCollector samples /proc and /sys under root ("/" on the device, a fake
+// tree in tests) and keeps a fixed-size history for sparklines.
+type sysCollector struct {
+	root      string
+	diskPath  string
+	thermal   string
+	addrsFunc func() ([]string, error)
+
+	prevCPU  cpuTimes
+	prevRx   uint64
+	prevTx   uint64
+	prevAt   time.Time
+	havePrev bool
+	history  []sysSample
+	next     int
+	full     bool
+}
+
+func newSysCollector(root string, capacity int) *sysCollector {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &sysCollector{
+		root:      root,
+		diskPath:  "/",
+		thermal:   "sys/class/thermal/thermal_zone0/temp",
+		addrsFunc: interfaceAddrs,
+		history:   make([]sysSample, capacity),
+	}
+}
+
+func (c *sysCollector) path(rel string) string {
+	return filepath.Join(c.root, rel)
+}
+
+// sample reads every metric once, appends it to the history and returns it.
+// Individual read failures are collected into the returned error but do not
+// stop the rest of the sample.
+func (c *sysCollector) sample(now time.Time) (sysSample, error) {
+	s := sysSample{at: now}
+	var errs []error
+
+	if cpu, err := readCPUTimes(c.path("proc/stat")); err != nil {
+		errs = append(errs, err)
+	} else {
+		if c.havePrev && cpu.total > c.prevCPU.total {
+			dt := float64(cpu.total - c.prevCPU.total)
+			di := float64(cpu.idle - c.prevCPU.idle)
+			s.cpuPct = 100 * (1 - di/dt)
+		}
+		c.prevCPU = cpu
+	}
+
+	if total, avail, err := readMemInfo(c.path("proc/meminfo")); err != nil {
+		errs = append(errs, err)
+	} else if total > 0 {
+		s.memTotalKB = total
+		s.memUsedPct = 100 * float64(total-avail) / float64(total)
+	}
+
+	if l1, l5, l15, err := readLoadAvg(c.path("proc/loadavg")); err != nil {
+		errs = append(errs, err)
+	} else {
+		s.load1, s.load5, s.load15 = l1, l5, l15
+	}
+
+	if t, err := readThermal(c.path(c.thermal)); err == nil {
+		s.tempC = t
+		s.hasTemp = true
+	}
+
+	if pct, err := diskUsedPct(c.path(c.diskPath)); err != nil {
+		errs = append(errs, err)
+	} else {
+		s.diskUsedPct = pct
+		s.hasDisk = true
+	}
+
+	if rx, tx, err := readNetDev(c.path("proc/net/dev")); err != nil {
+		errs = append(errs, err)
+	} else {
+		if c.havePrev && !c.prevAt.IsZero() {
+			if dt := now.Sub(c.prevAt).Seconds(); dt > 0 && rx >= c.prevRx && tx >= c.prevTx {
+				s.rxBps = float64(rx-c.prevRx) / dt
+				s.txBps = float64(tx-c.prevTx) / dt
+			}
+		}
+		c.prevRx, c.prevTx = rx, tx
+	}
+
+	if c.addrsFunc != nil {
+		if addrs, err := c.addrsFunc(); err != nil {
+			errs = append(errs, err)
+		} else {
+			s.addrs = addrs
+		}
+	}
+
+	c.prevAt = now
+	c.havePrev = true
+	c.history[c.next] = s
+	c.next = (c.next + 1) % len(c.history)
+	if c.next == 0 {
+		c.full = true
+	}
+	return s, errors.Join(errs...)
+}
+
+// samples returns the history oldest first.
+func (c *sysCollector) samples() []sysSample {
+	if !c.full {
+		return append([]sysSample(nil), c.history[:c.next]...)
+	}
+	out := make([]sysSample, 0, len(c.history))
+	out = append(out, c.history[c.next:]...)
+	return append(out, c.history[:c.next]...)
+}
+
+func readCPUTimes(path string) (cpuTimes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		// user nice system idle iowait irq softirq steal guest guest_nice;
+		// guest time is already in user and nice, so it stays out of the
+		// total.
+		var t cpuTimes
+		for i, v := range fields[1:min(len(fields), 9)] {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return cpuTimes{}, fmt.Errorf("%s: %w", path, err)
+			}
+			t.total += n
+			// idle and iowait
+			if i == 3 || i == 4 {
+				t.idle += n
+			}
+		}
+		return t, nil
+	}
+	return cpuTimes{}, fmt.Errorf("%s: no cpu line", path)
+}
+
+func readMemInfo(path string) (total, avail uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = n
+		case "MemAvailable:":
+			avail = n
+		}
+	}
+	if total == 0 {
+		return 0, 0, fmt.Errorf("%s: MemTotal missing", path)
+	}
+	return total, avail, nil
+}
+
+func readLoadAvg(path string) (float64, float64, float64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("%s: short read", path)
+	}
+	var v [3]float64
+	for i := range v {
+		if v[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return v[0], v[1], v[2], nil
+}
+
+func readThermal(path string) (float64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	milli, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return milli / 1000, nil
+}
+
+func diskUsedPct(path string) (float64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	total := float64(fs.Blocks) * float64(fs.Bsize)
+	free := float64(fs.Bavail) * float64(fs.Bsize)
+	if total <= 0 {
+		return 0, nil
+	}
+	return 100 * (total - free) / total, nil
+}
+
+// readNetDev sums received and transmitted bytes over all non-loopback
+// interfaces.
+func readNetDev(path string) (rx, tx uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, rest, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if name == "lo" {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			continue
+		}
+		r, err1 := strconv.ParseUint(fields[0], 10, 64)
+		t, err2 := strconv.ParseUint(fields[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		rx += r
+		tx += t
+	}
+	return rx, tx, sc.Err()
+}
+
+func interfaceAddrs() ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok || ipn.IP.IsLoopback() || ipn.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		out = append(out, ipn.IP.String())
+	}
+	// IPv4 first; they are shorter and fit the page.
+	sort.SliceStable(out, func(i, j int) bool {
+		return strings.Count(out[i], ":") < strings.Count(out[j], ":")
+	})
+	return out, nil
+}
+
+func formatBytesRate(bps float64) string {
+	switch {
+	case bps >= 1<<20:
+		return fmt.Sprintf("%.1fM", bps/(1<<20))
+	case bps >= 1<<10:
+		return fmt.Sprintf("%.0fk", bps/(1<<10))
+	default:
+		return fmt.Sprintf("%.0f", bps)
+	}
+}
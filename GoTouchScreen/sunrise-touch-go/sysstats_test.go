@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeProc writes the files sysCollector reads under a temp root.
+func fakeProc(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, body := range files {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const fakeNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 999999     100    0    0    0     0          0         0   999999     100    0    0    0     0       0          0
+  eth0: %d    1000    0    0    0     0          0         0   %d     900    0    0    0     0       0          0
+`
+
+func TestSysCollector(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, map[string]string{
+		// guest and guest_nice (the last two) are already in user and nice.
+		"proc/stat":                            "cpu  100 0 100 700 100 0 0 0 50 50\ncpu0 100 0 100 700 100 0 0 0 50 50\nintr 12345\n",
+		"proc/meminfo":                         "MemTotal:        1000000 kB\nMemFree:          100000 kB\nMemAvailable:     250000 kB\n",
+		"proc/loadavg":                         "0.52 0.58 0.59 1/123 4567\n",
+		"proc/net/dev":                         fmt.Sprintf(fakeNetDev, 10000, 5000),
+		"sys/class/thermal/thermal_zone0/temp": "48312\n",
+	})
+	c := newSysCollector(root, 2)
+	c.addrsFunc = func() ([]string, error) { return []string{"192.168.1.20"}, nil }
+
+	t0 := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	s, err := c.sample(t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.cpuPct != 0 || s.rxBps != 0 {
+		t.Errorf("first sample has rates: cpu %v rx %v", s.cpuPct, s.rxBps)
+	}
+	if s.memUsedPct != 75 || s.memTotalKB != 1000000 {
+		t.Errorf("memory %v%% of %d kB, want 75%% of 1000000", s.memUsedPct, s.memTotalKB)
+	}
+	if s.load1 != 0.52 || s.load5 != 0.58 || s.load15 != 0.59 {
+		t.Errorf("load %v %v %v", s.load1, s.load5, s.load15)
+	}
+	if !s.hasTemp || math.Abs(s.tempC-48.312) > 1e-9 {
+		t.Errorf("temp %v (has %v)", s.tempC, s.hasTemp)
+	}
+	if !s.hasDisk || s.diskUsedPct <= 0 || s.diskUsedPct > 100 {
+		t.Errorf("disk %v%% (has %v)", s.diskUsedPct, s.hasDisk)
+	}
+	if len(s.addrs) != 1 {
+		t.Errorf("addrs %v", s.addrs)
+	}
+
+	// 800 jiffies pass, 500 of them idle or iowait: 37.5% busy. Counting
+	// guest time twice would make it 900 and 44%.
+	fakeProc(t, root, map[string]string{
+		"proc/stat":    "cpu  300 0 200 1100 200 0 0 0 150 50\n",
+		"proc/net/dev": fmt.Sprintf(fakeNetDev, 12048, 5512),
+	})
+	s, err = c.sample(t0.Add(2 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.cpuPct != 37.5 {
+		t.Errorf("cpu %v%%, want 37.5%%", s.cpuPct)
+	}
+	if s.rxBps != 1024 || s.txBps != 256 {
+		t.Errorf("rx %v tx %v B/s, want 1024 and 256 (lo excluded)", s.rxBps, s.txBps)
+	}
+
+	// The history keeps the newest two, oldest first.
+	c.sample(t0.Add(4 * time.Second))
+	h := c.samples()
+	if len(h) != 2 || !h[0].at.Equal(t0.Add(2*time.Second)) || !h[1].at.Equal(t0.Add(4*time.Second)) {
+		t.Errorf("history %v", h)
+	}
+}
+
+func TestSysCollectorMissingFiles(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, map[string]string{"proc/loadavg": "1.00 2.00 3.00 1/1 1\n"})
+	c := newSysCollector(root, 4)
+	c.addrsFunc = nil
+	s, err := c.sample(time.Now())
+	if err == nil {
+		t.Error("no error for missing stat, meminfo and net/dev")
+	}
+	// What could be read still is.
+	if s.load15 != 3 || s.hasTemp {
+		t.Errorf("sample %+v", s)
+	}
+	if len(c.samples()) != 1 {
+		t.Error("partial sample not kept in history")
+	}
+}
+
+func TestReadCPUTimesShortLine(t *testing.T) {
+	// Older kernels stop at iowait or steal.
+	root := t.TempDir()
+	fakeProc(t, root, map[string]string{"proc/stat": "cpu  10 20 30 40 50\n"})
+	ct, err := readCPUTimes(filepath.Join(root, "proc/stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.total != 150 || ct.idle != 90 {
+		t.Errorf("got %+v, want total 150 idle 90", ct)
+	}
+}
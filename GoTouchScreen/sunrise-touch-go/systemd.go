@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sdNotify sends a state string such as "READY=1" to systemd. It is a no-op
+// when the service isn't run with Type=notify (NOTIFY_SOCKET unset).
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	return nil
+}
+
+// watchdogInterval returns how often to send WATCHDOG=1, half the WatchdogSec
+// systemd asked for, or 0 when no watchdog is configured for this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+const unitTemplate = `[Unit]
+Description=Sunrise Touch e-paper dashboard
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+User=%s
+SupplementaryGroups=spi i2c gpio
+%sExecStart=%s
+# READY=1 is sent once the panel initialises; the main loop pings the
+# watchdog, so a wedged SPI transfer or busy-wait gets the process restarted.
+WatchdogSec=60
+TimeoutStopSec=30
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// systemdQuote quotes an ExecStart word when it needs it.
+func systemdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\$%;") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// envFlags are the URL flags that can carry credentials (user:pass@ or a
+// secret path or query), with the variable each falls back to when unset.
+// install moves them into a root-only EnvironmentFile rather than the
+// world-readable unit, and out of the command line that ps shows.
+var envFlags = []struct{ flag, env string }{
+	{"mqtt", "SUNRISE_MQTT"},
+	{"calendar", "SUNRISE_CALENDAR"},
+	{"flights", "SUNRISE_FLIGHTS"},
+	{"ha-url", "SUNRISE_HA_URL"},
+	{"weather-url", "SUNRISE_WEATHER_URL"},
+}
+
+// applyEnvFlags sets each envFlags flag not given on the command line from
+// its variable.
+func applyEnvFlags(set *flag.FlagSet) error {
+	given := map[string]bool{}
+	set.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, e := range envFlags {
+		if v := os.Getenv(e.env); v != "" && !given[e.flag] {
+			if err := set.Set(e.flag, v); err != nil {
+				return fmt.Errorf("$%s: %w", e.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// envQuote quotes a value for an EnvironmentFile line.
+func envQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// writeUnit renders the service unit. ExecStart repeats the flags given on
+// this command line, so "sunrise-touch-go -partial install" installs a
+// service that runs with -partial. envFlags are written to env instead, and
+// the unit loads them from envPath.
+func writeUnit(w, env io.Writer, username, exe, envPath string, set *flag.FlagSet) error {
+	if username == "" {
+		return errors.New("no user for the service")
+	}
+	secret := map[string]string{}
+	for _, e := range envFlags {
+		secret[e.flag] = e.env
+	}
+	args := []string{systemdQuote(exe)}
+	var envLines []string
+	hasConfig := false
+	set.Visit(func(f *flag.Flag) {
+		hasConfig = hasConfig || f.Name == "config"
+		if name, ok := secret[f.Name]; ok {
+			envLines = append(envLines, name+"="+envQuote(f.Value.String()))
+			return
+		}
+		args = append(args, systemdQuote("-"+f.Name+"="+f.Value.String()))
+	})
+	// Always pin the config path so the unit states where settings live.
+	if c := set.Lookup("config"); c != nil && !hasConfig {
+		args = append(args, systemdQuote("-config="+c.Value.String()))
+	}
+	envLine := ""
+	if len(envLines) > 0 {
+		if _, err := io.WriteString(env, strings.Join(envLines, "\n")+"\n"); err != nil {
+			return err
+		}
+		envLine = "# URLs that may hold credentials; root-only, read before User= applies.\nEnvironmentFile=" + envPath + "\n"
+	}
+	_, err := fmt.Fprintf(w, unitTemplate, username, envLine, strings.Join(args, " "))
+	return err
+}
+
+// runInstall implements "install [-user name] [-unit path] [-env path]". The
+// unit goes to /etc/systemd/system by default, or stdout with -unit -; any
+// envFlags go to the -env file, which is written even then.
+func runInstall(args []string) error {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	defUser := os.Getenv("SUDO_USER")
+	if defUser == "" {
+		if u, err := user.Current(); err == nil {
+			defUser = u.Username
+		}
+	}
+	username := fs.String("user", defUser, "user the service runs as")
+	unitPath := fs.String("unit", "/etc/systemd/system/sunrise-touch-go.service", "unit file to write, or - for stdout")
+	envPath := fs.String("env", "/etc/default/sunrise-touch-go", "EnvironmentFile for credential-bearing URLs, written mode 0600")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var unit, env bytes.Buffer
+	if err := writeUnit(&unit, &env, *username, exe, *envPath, flag.CommandLine); err != nil {
+		return err
+	}
+	if env.Len() > 0 {
+		if err := writeFileMode(*envPath, env.Bytes(), 0o600); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "wrote %s (mode 0600)\n", *envPath)
+	}
+	if *unitPath == "-" {
+		_, err := os.Stdout.Write(unit.Bytes())
+		return err
+	}
+	if err := writeFileMode(*unitPath, unit.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\nenable with: systemctl daemon-reload && systemctl enable --now sunrise-touch-go\n", *unitPath)
+	return nil
+}
+
+// writeFileMode writes path with exactly perm, also when it already exists
+// with a looser one.
+func writeFileMode(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/inconsolata"
+)
+
+// uiTheme is a data-driven look for the dashboard. Built-in themes are always
+// available; extra ones are loaded from *.json files in the themes directory.
+type uiTheme struct {
+	Name        string `json:"name"`
+	Background  uint8  `json:"background"`
+	Foreground  uint8  `json:"foreground"`
+	ButtonStyle string `json:"button_style"` // filled, outlined, rounded
+	BorderWidth int    `json:"border_width"`
+	Font        string `json:"font"`    // 7x13, inconsolata, inconsolata-bold
+	Pattern     string `json:"pattern"` // none, dots, hatch, checker
+}
+
+func builtinThemes() []uiTheme {
+	return []uiTheme{
+		{Name: "light", Background: 255, Foreground: 0, ButtonStyle: "outlined", BorderWidth: 1, Font: "7x13", Pattern: "none"},
+		{Name: "dark", Background: 0, Foreground: 255, ButtonStyle: "outlined", BorderWidth: 1, Font: "7x13", Pattern: "none"},
+		{Name: "bold", Background: 255, Foreground: 0, ButtonStyle: "filled", BorderWidth: 2, Font: "inconsolata-bold", Pattern: "none"},
+	}
+}
+
+// loadThemes returns the built-in themes followed by any valid themes found in
+// dir, in file name order. A theme whose name matches a built-in replaces it
+// in place.
+func loadThemes(dir string) ([]uiTheme, []error) {
+	themes := builtinThemes()
+	if dir == "" {
+		return themes, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return themes, []error{err}
+	}
+	sort.Strings(paths)
+	var errs []error
+	for _, p := range paths {
+		th, err := loadThemeFile(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+			continue
+		}
+		replaced := false
+		for i := range themes {
+			if themes[i].Name == th.Name {
+				themes[i] = th
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			themes = append(themes, th)
+		}
+	}
+	return themes, errs
+}
+
+func loadThemeFile(path string) (uiTheme, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return uiTheme{}, err
+	}
+	// Defaults for fields a theme file leaves out.
+	th := uiTheme{Background: 255, Foreground: 0, ButtonStyle: "outlined", BorderWidth: 1, Font: "7x13", Pattern: "none"}
+	if err := json.Unmarshal(b, &th); err != nil {
+		return uiTheme{}, err
+	}
+	if th.Name == "" {
+		th.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := th.validate(); err != nil {
+		return uiTheme{}, err
+	}
+	return th, nil
+}
+
+func (th uiTheme) validate() error {
+	switch th.ButtonStyle {
+	case "filled", "outlined", "rounded":
+	default:
+		return fmt.Errorf("unknown button_style %q", th.ButtonStyle)
+	}
+	switch th.Font {
+	case "7x13", "inconsolata", "inconsolata-bold":
+	default:
+		return fmt.Errorf("unknown font %q", th.Font)
+	}
+	switch th.Pattern {
+	case "none", "dots", "hatch", "checker":
+	default:
+		return fmt.Errorf("unknown pattern %q", th.Pattern)
+	}
+	if th.BorderWidth < 1 || th.BorderWidth > 4 {
+		return fmt.Errorf("border_width %d out of range 1..4", th.BorderWidth)
+	}
+	if th.Background == th.Foreground {
+		return errors.New("background and foreground must differ")
+	}
+	return nil
+}
+
+func (th uiTheme) face() font.Face {
+	switch th.Font {
+	case "inconsolata":
+		return inconsolata.Regular8x16
+	case "inconsolata-bold":
+		return inconsolata.Bold8x16
+	default:
+		return basicfont.Face7x13
+	}
+}
+
+func themeIndex(themes []uiTheme, name string) int {
+	for i, th := range themes {
+		if th.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (st appState) currentTheme() uiTheme {
+	if st.theme >= 0 && st.theme < len(st.themes) {
+		return st.themes[st.theme]
+	}
+	return builtinThemes()[0]
+}
+
+func (st appState) nextTheme() int {
+	n := len(st.themes)
+	if n == 0 {
+		return 0
+	}
+	return (st.theme + 1) % n
+}
+
+// fillPattern lays a sparse foreground texture over the background. It stays
+// sparse so text drawn on top remains legible after 1-bit conversion.
+func fillPattern(img *image.Gray, pattern string, fg uint8) {
+	c := color.Gray{Y: fg}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			on := false
+			switch pattern {
+			case "dots":
+				on = x%6 == 0 && y%6 == 0
+			case "hatch":
+				on = (x+y)%8 == 0
+			case "checker":
+				on = (x/8+y/8)%2 == 0 && x%2 == 0 && y%2 == 0
+			}
+			if on {
+				img.SetGray(x, y, c)
+			}
+		}
+	}
+}
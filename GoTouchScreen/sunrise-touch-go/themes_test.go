@@ -0,0 +1,40 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// inkBounds is the box around every pixel that isn't the background.
+func inkBounds(img *image.Gray, bg uint8) image.Rectangle {
+	var r image.Rectangle
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			if img.GrayAt(x, y).Y != bg {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestTextUsesThemeFace(t *testing.T) {
+	const s = "NEXT SUNRISE"
+	draw := func(th uiTheme) *image.Gray {
+		img := image.NewGray(image.Rect(0, 0, 250, 122))
+		fillRect(img, 0, 0, 249, 121, th.Background)
+		text(img, 8, 38, s, th.Foreground, th)
+		return img
+	}
+	light, bold := builtinThemes()[0], builtinThemes()[2]
+	a, b := draw(light), draw(bold)
+	if string(a.Pix) == string(b.Pix) {
+		t.Fatal("bold theme text drawn in the default face")
+	}
+	// The wider face keeps the 7px grid the layouts are measured on.
+	for _, img := range []*image.Gray{a, b} {
+		if ink := inkBounds(img, 255); ink.Empty() || ink.Max.X > 8+7*len(s)+1 {
+			t.Errorf("ink %v runs past %d", ink, 8+7*len(s))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the zone database so a configured zone resolves even on images
+	// without /usr/share/zoneinfo.
+	_ "time/tzdata"
+)
+
+//go:embed cities.tsv
+var citiesTSV string
+
+type city struct {
+	name    string
+	country string
+	lat     float64
+	lon     float64
+	tz      string
+}
+
+var cities = parseCities(citiesTSV)
+
+func parseCities(data string) []city {
+	var out []city
+	for _, ln := range strings.Split(data, "\n") {
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		f := strings.Split(ln, "\t")
+		if len(f) != 5 {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(f[2], 64)
+		lon, err2 := strconv.ParseFloat(f[3], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		out = append(out, city{name: f[0], country: f[1], lat: lat, lon: lon, tz: f[4]})
+	}
+	return out
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	dLat := deg2rad(lat2 - lat1)
+	dLon := deg2rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(deg2rad(lat1))*math.Cos(deg2rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// resolveTimezone maps the timezone setting to a location: "" or "local" is
+// the system zone, anything else must be an IANA name. There is no lookup
+// from lat/lon; picking a city in SET adopts that city's zone.
+func resolveTimezone(setting string) (*time.Location, error) {
+	switch setting {
+	case "", "local":
+		return time.Local, nil
+	case "auto":
+		return nil, fmt.Errorf("timezone \"auto\" is not supported; set an IANA name such as America/Chicago")
+	default:
+		return time.LoadLocation(setting)
+	}
+}
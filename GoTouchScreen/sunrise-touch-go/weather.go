@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font/inconsolata"
+)
+
+// weatherReport is what the weather page needs, whatever the provider.
+type weatherReport struct {
+	Provider string    `json:"provider"`
+	Fetched  time.Time `json:"fetched"`
+	Lat      float64   `json:"lat"`
+	Lon      float64   `json:"lon"`
+	TempC    float64   `json:"temp_c"`
+	Code     int       `json:"code"` // WMO weather interpretation code
+	WindKmh  float64   `json:"wind_kmh"`
+	HighC    float64   `json:"high_c"`
+	LowC     float64   `json:"low_c"`
+	// PrecipMm is hourly precipitation starting at PrecipFrom.
+	PrecipFrom time.Time `json:"precip_from"`
+	PrecipMm   []float64 `json:"precip_mm"`
+}
+
+type weatherProvider interface {
+	Name() string
+	Fetch(ctx context.Context, lat, lon float64) (weatherReport, error)
+}
+
+// openMeteo reads the Open-Meteo forecast API. baseURL can point at a local
+// fixture server, as the tests do.
+type openMeteo struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (o openMeteo) Name() string { return "open-meteo" }
+
+type openMeteoResponse struct {
+	UTCOffsetSeconds int `json:"utc_offset_seconds"`
+	Current          struct {
+		Time        string  `json:"time"`
+		Temperature float64 `json:"temperature_2m"`
+		WeatherCode int     `json:"weather_code"`
+		WindSpeed   float64 `json:"wind_speed_10m"`
+	} `json:"current"`
+	Hourly struct {
+		Time          []string  `json:"time"`
+		Precipitation []float64 `json:"precipitation"`
+	} `json:"hourly"`
+	Daily struct {
+		Time []string  `json:"time"`
+		Max  []float64 `json:"temperature_2m_max"`
+		Min  []float64 `json:"temperature_2m_min"`
+	} `json:"daily"`
+}
+
+func (o openMeteo) Fetch(ctx context.Context, lat, lon float64) (weatherReport, error) {
+	q := url.Values{}
+	q.Set("latitude", fmt.Sprintf("%.4f", lat))
+	q.Set("longitude", fmt.Sprintf("%.4f", lon))
+	q.Set("current", "temperature_2m,weather_code,wind_speed_10m")
+	q.Set("hourly", "precipitation")
+	q.Set("daily", "temperature_2m_max,temperature_2m_min")
+	q.Set("timezone", "auto")
+	q.Set("forecast_days", "2")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/v1/forecast?"+q.Encode(), nil)
+	if err != nil {
+		return weatherReport{}, err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return weatherReport{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return weatherReport{}, fmt.Errorf("open-meteo: %s", resp.Status)
+	}
+	var r openMeteoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return weatherReport{}, fmt.Errorf("open-meteo: %w", err)
+	}
+	return r.report(lat, lon, time.Now())
+}
+
+// report converts a response, taking today as the day containing its current
+// time in the location's own offset.
+func (r openMeteoResponse) report(lat, lon float64, fetched time.Time) (weatherReport, error) {
+	zone := time.FixedZone("", r.UTCOffsetSeconds)
+	cur, err := time.ParseInLocation("2006-01-02T15:04", r.Current.Time, zone)
+	if err != nil {
+		return weatherReport{}, fmt.Errorf("open-meteo: current time: %w", err)
+	}
+	w := weatherReport{
+		Provider: "open-meteo",
+		Fetched:  fetched,
+		Lat:      lat,
+		Lon:      lon,
+		TempC:    r.Current.Temperature,
+		Code:     r.Current.WeatherCode,
+		WindKmh:  r.Current.WindSpeed,
+	}
+	today := cur.Format("2006-01-02")
+	found := false
+	for i, d := range r.Daily.Time {
+		if d == today && i < len(r.Daily.Max) && i < len(r.Daily.Min) {
+			w.HighC, w.LowC = r.Daily.Max[i], r.Daily.Min[i]
+			found = true
+		}
+	}
+	if !found {
+		return weatherReport{}, errors.New("open-meteo: no daily entry for today")
+	}
+	hour := cur.Truncate(time.Hour)
+	for i, ts := range r.Hourly.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", ts, zone)
+		if err != nil || t.Before(hour) || i >= len(r.Hourly.Precipitation) {
+			continue
+		}
+		if w.PrecipFrom.IsZero() {
+			w.PrecipFrom = t
+		}
+		w.PrecipMm = append(w.PrecipMm, r.Hourly.Precipitation[i])
+		if len(w.PrecipMm) == 24 {
+			break
+		}
+	}
+	return w, nil
+}
+
+// weatherService fetches in the background so a slow network never stalls
+// the touch loop, and keeps the last good report on disk for offline starts.
+type weatherService struct {
+	provider  weatherProvider
+	cachePath string
+	every     time.Duration
+	updated   chan struct{}
+
+	mu       sync.Mutex
+	lat, lon float64
+	report   weatherReport
+	have     bool
+	lastErr  error
+	moved    chan struct{}
+}
+
+func newWeatherService(p weatherProvider, cachePath string, every time.Duration) *weatherService {
+	s := &weatherService{
+		provider:  p,
+		cachePath: cachePath,
+		every:     every,
+		updated:   make(chan struct{}, 1),
+		moved:     make(chan struct{}, 1),
+	}
+	if r, err := loadWeatherCache(cachePath); err == nil {
+		s.report, s.have = r, true
+		logWeather.Info("cache loaded", "fetched", r.Fetched)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logWeather.Warn("cache load failed", "err", err)
+	}
+	return s
+}
+
+func loadWeatherCache(path string) (weatherReport, error) {
+	var r weatherReport
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(b, &r)
+	return r, err
+}
+
+func saveWeatherCache(path string, r weatherReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// setLocation is called from the main loop; a move triggers a fetch now.
+func (s *weatherService) setLocation(lat, lon float64) {
+	s.mu.Lock()
+	changed := lat != s.lat || lon != s.lon
+	s.lat, s.lon = lat, lon
+	s.mu.Unlock()
+	if changed {
+		select {
+		case s.moved <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// latest returns the last good report and whether it is stale: the last
+// fetch failed, or it is older than two fetch intervals.
+func (s *weatherService) latest(now time.Time) (weatherReport, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stale := s.lastErr != nil || now.Sub(s.report.Fetched) > 2*s.every ||
+		haversineKm(s.lat, s.lon, s.report.Lat, s.report.Lon) > 25
+	return s.report, stale, s.have
+}
+
+func (s *weatherService) run(ctx context.Context) {
+	// The first setLocation from the main loop triggers the initial fetch.
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.moved:
+		case <-timer.C:
+		}
+		s.fetch(ctx)
+		timer.Reset(s.every)
+	}
+}
+
+func (s *weatherService) fetch(ctx context.Context) {
+	s.mu.Lock()
+	lat, lon := s.lat, s.lon
+	s.mu.Unlock()
+
+	fctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	r, err := s.provider.Fetch(fctx, lat, lon)
+
+	s.mu.Lock()
+	s.lastErr = err
+	if err == nil {
+		s.report, s.have = r, true
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		logWeather.Warn("fetch failed", "provider", s.provider.Name(), "err", err)
+	} else {
+		logWeather.Debug("fetched", "provider", s.provider.Name(), "temp_c", r.TempC)
+		if err := saveWeatherCache(s.cachePath, r); err != nil {
+			logWeather.Warn("cache save failed", "err", err)
+		}
+	}
+	select {
+	case s.updated <- struct{}{}:
+	default:
+	}
+}
+
+// weatherCodeText names WMO weather interpretation codes in a few letters.
+func weatherCodeText(code int) string {
+	switch {
+	case code == 0:
+		return "Clear"
+	case code <= 2:
+		return "Partly cloudy"
+	case code == 3:
+		return "Overcast"
+	case code == 45 || code == 48:
+		return "Fog"
+	case code >= 51 && code <= 57:
+		return "Drizzle"
+	case code >= 61 && code <= 67, code >= 80 && code <= 82:
+		return "Rain"
+	case code >= 71 && code <= 77, code == 85 || code == 86:
+		return "Snow"
+	case code >= 95:
+		return "Thunderstorm"
+	default:
+		return fmt.Sprintf("Code %d", code)
+	}
+}
+
+func renderWeatherPage(img *image.Gray, now time.Time, ws *weatherService, th uiTheme) {
+	fg := th.Foreground
+	if ws == nil {
+		text(img, 8, 38, "WEATHER off", fg, th)
+		return
+	}
+	r, stale, ok := ws.latest(now)
+	if !ok {
+		text(img, 8, 38, "WEATHER", fg, th)
+		text(img, 8, 60, "waiting for", fg, th)
+		text(img, 8, 74, "first fetch...", fg, th)
+		return
+	}
+	text(img, 8, 38, weatherCodeText(r.Code), fg, th)
+	textFace(img, 8, 60, fmt.Sprintf("%.1fC", r.TempC), fg, inconsolata.Bold8x16)
+	text(img, 8, 78, fmt.Sprintf("H %.0f  L %.0f", r.HighC, r.LowC), fg, th)
+	text(img, 8, 92, fmt.Sprintf("WIND %.0fkm/h", r.WindKmh), fg, th)
+	fetched := r.Fetched.In(now.Location()).Format("15:04")
+	if stale {
+		// Invert so an old reading can't pass for a live one.
+		fillRect(img, 2, 98, 123, 112, fg)
+		text(img, 4, 109, "STALE since "+fetched, th.Background, th)
+	} else {
+		text(img, 8, 109, "upd "+fetched, fg, th)
+	}
+
+	text(img, 132, 50, "RAIN 24h", fg, th)
+	box := rect{132, 56, 229, 84}
+	rectOutline(img, box.x0, box.y0, box.x1, box.y1, fg)
+	hi, total, peak := 1.0, 0.0, -1
+	for i, v := range r.PrecipMm {
+		total += v
+		if v > hi {
+			hi = v
+		}
+		if peak < 0 || v > r.PrecipMm[peak] {
+			peak = i
+		}
+	}
+	// Four pixel columns per hour fills the box with 24 hours.
+	var cols []float64
+	for _, v := range r.PrecipMm {
+		cols = append(cols, v, v, v, v)
+	}
+	sparkline(img, rect{box.x0 + 1, box.y0 + 2, box.x1 - 1, box.y1 - 1}, cols, 0, hi, fg)
+	text(img, 132, 98, fmt.Sprintf("SUM %.1fmm", total), fg, th)
+	if peak >= 0 && r.PrecipMm[peak] > 0 {
+		at := r.PrecipFrom.Add(time.Duration(peak) * time.Hour).In(now.Location())
+		text(img, 132, 112, fmt.Sprintf("PEAK %s", at.Format("15:04")), fg, th)
+	} else {
+		text(img, 132, 112, "DRY", fg, th)
+	}
+}
+
+type weatherPage struct {
+	pageDefaults
+	ws *weatherService
+}
+
+func (weatherPage) Title() string { return "weather" }
+
+func (p weatherPage) Render(img *image.Gray, pc pageContext) {
+	renderWeatherPage(img, pc.now, p.ws, pc.th)
+}
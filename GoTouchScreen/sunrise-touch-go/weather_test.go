@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openMeteoFixture serves testdata/open_meteo_forecast.json, a canned
+// /v1/forecast response for San Francisco on 2026-10-19, or a 503 while fail
+// is set.
+func openMeteoFixture(t *testing.T) (*httptest.Server, *atomic.Bool) {
+	b, err := os.ReadFile(filepath.Join("testdata", "open_meteo_forecast.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/forecast" || r.URL.Query().Get("latitude") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fail
+}
+
+func TestOpenMeteoReport(t *testing.T) {
+	srv, _ := openMeteoFixture(t)
+	o := openMeteo{baseURL: srv.URL, client: srv.Client()}
+	r, err := o.Fetch(context.Background(), 37.77, -122.42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Provider != "open-meteo" || r.TempC != 14.6 || r.Code != 61 || r.WindKmh != 17.3 {
+		t.Errorf("current = %+v", r)
+	}
+	if r.HighC != 18.2 || r.LowC != 11.4 {
+		t.Errorf("today high/low = %v/%v, want 18.2/11.4", r.HighC, r.LowC)
+	}
+	// Precipitation starts at the current hour, in the location's offset.
+	if got := r.PrecipFrom.Format("2006-01-02T15:04-07:00"); got != "2026-10-19T09:00-07:00" {
+		t.Errorf("precip from %s", got)
+	}
+	if len(r.PrecipMm) != 24 || r.PrecipMm[4] != 0.1 {
+		t.Errorf("precip = %v", r.PrecipMm)
+	}
+	if weatherCodeText(r.Code) != "Rain" {
+		t.Errorf("code text %q", weatherCodeText(r.Code))
+	}
+
+	var bad openMeteoResponse
+	bad.Current.Time = "2026-10-19T09:15"
+	if _, err := bad.report(0, 0, time.Now()); err == nil {
+		t.Error("report without a daily entry for today succeeded")
+	}
+	bad.Current.Time = "yesterday"
+	if _, err := bad.report(0, 0, time.Now()); err == nil {
+		t.Error("report with a bad current time succeeded")
+	}
+}
+
+func TestWeatherCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "weather.json")
+	want := weatherReport{
+		Provider: "open-meteo", Fetched: time.Date(2026, 10, 19, 16, 15, 0, 0, time.UTC),
+		Lat: 37.77, Lon: -122.42, TempC: 14.6, Code: 61, HighC: 18.2, LowC: 11.4,
+		PrecipFrom: time.Date(2026, 10, 19, 16, 0, 0, 0, time.UTC), PrecipMm: []float64{0, 0.1, 0.4},
+	}
+	if err := saveWeatherCache(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadWeatherCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := json.Marshal(got)
+	b, _ := json.Marshal(want)
+	if string(a) != string(b) {
+		t.Errorf("round trip:\n got %s\nwant %s", a, b)
+	}
+	// A new service starts from the cache before its first fetch.
+	s := newWeatherService(openMeteo{}, path, time.Hour)
+	if r, _, ok := s.latest(want.Fetched); !ok || r.TempC != want.TempC {
+		t.Errorf("service did not load the cache: %+v", r)
+	}
+}
+
+func TestWeatherStale(t *testing.T) {
+	srv, fail := openMeteoFixture(t)
+	path := filepath.Join(t.TempDir(), "weather.json")
+	s := newWeatherService(openMeteo{baseURL: srv.URL, client: srv.Client()}, path, 15*time.Minute)
+	s.setLocation(37.77, -122.42)
+	ctx := context.Background()
+
+	s.fetch(ctx)
+	r, stale, ok := s.latest(time.Now())
+	if !ok || stale {
+		t.Fatalf("fresh fetch: ok=%v stale=%v", ok, stale)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("cache not written: %v", err)
+	}
+	if _, stale, _ := s.latest(r.Fetched.Add(31 * time.Minute)); !stale {
+		t.Error("report older than two intervals not stale")
+	}
+
+	fail.Store(true)
+	s.fetch(ctx)
+	got, stale, ok := s.latest(time.Now())
+	if !ok || !stale || got.TempC != r.TempC {
+		t.Errorf("failed fetch: ok=%v stale=%v, kept %+v", ok, stale, got)
+	}
+
+	fail.Store(false)
+	s.fetch(ctx)
+	s.setLocation(38.58, -121.49) // Sacramento, well over 25 km away
+	if _, stale, _ := s.latest(time.Now()); !stale {
+		t.Error("report for the old location not stale after a move")
+	}
+}